@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"videoforge/config"
+	"videoforge/models"
+	"videoforge/worker"
+)
+
+// authorizeAgent 校验远程 worker 的令牌，未配置 remote.token 时不校验
+func authorizeAgent(w http.ResponseWriter, r *http.Request) bool {
+	token := config.GlobalConfig.Remote.Token
+	if token == "" || r.Header.Get("Authorization") == "Bearer "+token {
+		return true
+	}
+	respondError(w, http.StatusUnauthorized, "Invalid worker token")
+	return false
+}
+
+// ClaimTask 远程 worker 领取任务，没有可领取的任务时返回 204
+func (s *Server) ClaimTask(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAgent(w, r) {
+		return
+	}
+
+	var req models.ClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WorkerID == "" {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	task, expiresAt, err := s.queue.ClaimTask(req)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if task == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.ClaimResponse{
+		Task:           task,
+		LeaseExpiresAt: expiresAt,
+		LeaseDuration:  int(time.Until(expiresAt).Round(time.Second).Seconds()),
+	})
+}
+
+// HeartbeatTask 远程 worker 续约并上报进度，任务已被取消时返回 410，租约已失效时返回 409
+func (s *Server) HeartbeatTask(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAgent(w, r) {
+		return
+	}
+
+	id, err := parseAgentTaskID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	var hb models.Heartbeat
+	if err := json.NewDecoder(r.Body).Decode(&hb); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	expiresAt, err := s.queue.RenewLease(id, hb)
+	if err != nil {
+		respondLeaseError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]interface{}{"leaseExpiresAt": expiresAt})
+}
+
+// CompleteTask 远程 worker 上报执行结果
+func (s *Server) CompleteTask(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAgent(w, r) {
+		return
+	}
+
+	id, err := parseAgentTaskID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	var result models.TaskResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := s.queue.CompleteRemoteTask(id, result); err != nil {
+		respondLeaseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReleaseTask 远程 worker 放弃任务，任务回到 pending
+func (s *Server) ReleaseTask(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAgent(w, r) {
+		return
+	}
+
+	id, err := parseAgentTaskID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	var hb models.Heartbeat
+	if err := json.NewDecoder(r.Body).Decode(&hb); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := s.queue.ReleaseLease(id, hb.WorkerID); err != nil {
+		respondLeaseError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func respondLeaseError(w http.ResponseWriter, err error) {
+	if errors.Is(err, worker.ErrLeaseCanceled) {
+		respondError(w, http.StatusGone, "Task canceled")
+		return
+	}
+	if errors.Is(err, worker.ErrLeaseLost) {
+		respondError(w, http.StatusConflict, "Lease lost")
+		return
+	}
+	respondError(w, http.StatusInternalServerError, err.Error())
+}
+
+// parseAgentTaskID 从 /api/agent/tasks/{id}/{action} 路径中解析任务 ID
+func parseAgentTaskID(path string) (int64, error) {
+	return parseTaskID(strings.Replace(path, "/api/agent/tasks/", "/api/tasks/", 1))
+}
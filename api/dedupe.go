@@ -0,0 +1,97 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"videoforge/config"
+	"videoforge/models"
+)
+
+// 提交重复任务（内容键相同且未失败、未取消）时的处理方式
+const (
+	duplicateAllow  = "allow"  // 仍然创建新任务
+	duplicateReject = "reject" // 拒绝，返回 409 和已有任务
+	duplicateReturn = "return" // 不创建，直接返回已有任务
+	duplicateMerge  = "merge"  // 返回已有任务，等待中的已有任务提高到新请求的优先级
+)
+
+// duplicatePolicy 请求未指定时使用 dedupe.onDuplicate 配置，默认 return
+func duplicatePolicy(requested string) (string, error) {
+	policy := requested
+	if policy == "" {
+		policy = config.GlobalConfig.Dedupe.OnDuplicate
+	}
+	switch policy {
+	case "":
+		return duplicateReturn, nil
+	case duplicateAllow, duplicateReject, duplicateReturn, duplicateMerge:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid onDuplicate: %s", policy)
+	}
+}
+
+// contentKey 由输入文件的绝对路径、大小、修改时间、任务类型和规范化后的参数计算内容键
+func contentKey(inputPath string, info os.FileInfo, taskType models.TaskType, paramsJSON string) string {
+	absPath, err := filepath.Abs(inputPath)
+	if err != nil {
+		absPath = inputPath
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00%s\x00%s", absPath, info.Size(), info.ModTime().UnixNano(), taskType, normalizeParams(paramsJSON))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeParams 去掉空值并按键排序，使 {"bitrate": "", "videoCodec": "h264"} 与 {"videoCodec": "h264"} 等价
+func normalizeParams(paramsJSON string) string {
+	var params interface{}
+	if err := json.Unmarshal([]byte(paramsJSON), &params); err != nil {
+		return paramsJSON
+	}
+
+	params = pruneEmpty(params)
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return paramsJSON
+	}
+	return string(data)
+}
+
+func pruneEmpty(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		pruned := make(map[string]interface{}, len(value))
+		for k, item := range value {
+			if item = pruneEmpty(item); item != nil {
+				pruned[k] = item
+			}
+		}
+		return pruned
+	case []interface{}:
+		for i, item := range value {
+			value[i] = pruneEmpty(item)
+		}
+		return value
+	case string:
+		if value == "" {
+			return nil
+		}
+	case float64:
+		if value == 0 {
+			return nil
+		}
+	case bool:
+		if !value {
+			return nil
+		}
+	}
+	return v
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// errInvalidWeight 公平调度的权重不能为负数
+var errInvalidWeight = errors.New("weight must not be negative")
+
+// requestOwner 任务的提交者：请求体中的 owner 优先，其次是 X-Owner 请求头
+func requestOwner(r *http.Request, owner string) string {
+	if owner = strings.TrimSpace(owner); owner != "" {
+		return owner
+	}
+	return strings.TrimSpace(r.Header.Get("X-Owner"))
+}
+
+// newBatchID 为一次批量提交或流水线生成批次 ID
+func newBatchID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return time.Now().Format("20060102") + "-" + hex.EncodeToString(b)
+}
+
+// GetQueuePositions 按公平调度的顺序估算等待中任务的排队位置和等待时间。
+// 可选参数 owner 只返回该提交者的任务，未指定时使用 X-Owner 请求头
+func (s *Server) GetQueuePositions(w http.ResponseWriter, r *http.Request) {
+	positions, err := s.queue.QueuePositions(requestOwner(r, r.URL.Query().Get("owner")))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get queue positions")
+		return
+	}
+	if positions == nil {
+		respondJSON(w, http.StatusOK, []interface{}{})
+		return
+	}
+	respondJSON(w, http.StatusOK, positions)
+}
+
+// GetTaskPosition 获取等待中任务的排队位置和预计等待时间
+func (s *Server) GetTaskPosition(w http.ResponseWriter, r *http.Request) {
+	id, err := parseTaskID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	task, err := s.db.GetTask(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+
+	positions, err := s.queue.QueuePositions(task.Owner)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get queue positions")
+		return
+	}
+	for _, p := range positions {
+		if p.TaskID == id {
+			respondJSON(w, http.StatusOK, p)
+			return
+		}
+	}
+	respondError(w, http.StatusConflict, "Task is not waiting in queue")
+}
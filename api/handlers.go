@@ -1,24 +1,32 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"videoforge/config"
 	"videoforge/database"
 	"videoforge/ffmpeg"
 	"videoforge/models"
+	"videoforge/processor"
 	"videoforge/worker"
 )
 
 type Server struct {
 	db    *database.DB
 	queue *worker.TaskQueue
+
+	submitMu      sync.Mutex // 串行化重复任务检查与创建
+	idempotencyMu keyedMutex // 串行化 Idempotency-Key 相同的请求
 }
 
 func NewServer(db *database.DB, queue *worker.TaskQueue) *Server {
@@ -104,11 +112,19 @@ func (s *Server) BrowseDirectory(w http.ResponseWriter, r *http.Request) {
 // CreateTask 创建任务
 func (s *Server) CreateTask(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		InputPath      string          `json:"inputPath"`
-		OutputPath     string          `json:"outputPath"`
-		Type           models.TaskType `json:"type"`
-		Params         interface{}     `json:"params"`
-		DeleteOriginal bool            `json:"deleteOriginal"`
+		InputPath      string              `json:"inputPath"`
+		OutputPath     string              `json:"outputPath"`
+		Type           models.TaskType     `json:"type"`
+		Params         interface{}         `json:"params"`
+		DeleteOriginal bool                `json:"deleteOriginal"`
+		Priority       int                 `json:"priority"`
+		RetryPolicy    *models.RetryPolicy `json:"retryPolicy"`
+		NotBefore      *time.Time          `json:"notBefore"`
+		OnDuplicate    string              `json:"onDuplicate"` // allow、reject、return、merge
+		OnConflict     string              `json:"onConflict"`  // overwrite、skip、rename、fail
+		Hooks          []models.Hook       `json:"hooks"`
+		Owner          string              `json:"owner"`  // 提交者，省略时使用 X-Owner 请求头
+		Weight         int                 `json:"weight"` // 公平调度的权重
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -116,69 +132,242 @@ func (s *Server) CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Weight < 0 {
+		respondError(w, http.StatusBadRequest, errInvalidWeight.Error())
+		return
+	}
+	policy, err := duplicatePolicy(req.OnDuplicate)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := worker.ValidateHooks(req.Hooks, true); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	conflictPolicy, err := worker.ConflictPolicy(req.OnConflict)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// 验证输入文件存在
-	if _, err := os.Stat(req.InputPath); err != nil {
+	info, err := os.Stat(req.InputPath)
+	if err != nil {
 		respondError(w, http.StatusBadRequest, "Input file not found")
 		return
 	}
 
 	paramsJSON, _ := json.Marshal(req.Params)
+	if err := processor.Validate(req.Type, string(paramsJSON)); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	outputPath := req.OutputPath
 	if outputPath == "" {
-		outputPath = generateOutputPath(req.InputPath, req.Type, config.GlobalConfig.FFmpeg.DefaultOutputDir, req.Params)
+		outputPath = generateOutputPath(req.InputPath, req.Type, config.GlobalConfig.FFmpeg.DefaultOutputDir, string(paramsJSON))
 	}
 
 	task := &models.Task{
 		InputPath:      req.InputPath,
-		OutputPath:     req.OutputPath,
+		OutputPath:     outputPath,
 		Type:           req.Type,
 		Params:         string(paramsJSON),
 		DeleteOriginal: req.DeleteOriginal,
+		Priority:       req.Priority,
+		RetryPolicy:    req.RetryPolicy,
+		NotBefore:      req.NotBefore,
+		Hooks:          req.Hooks,
+		Owner:          requestOwner(r, req.Owner),
+		Weight:         req.Weight,
 		Status:         models.TaskStatusPending,
 	}
 
-	if err := s.queue.AddTask(task); err != nil {
+	s.submitMu.Lock()
+	defer s.submitMu.Unlock()
+
+	sub, err := s.planTask(task, info, policy, conflictPolicy, s.newOutputIndex())
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create task")
+		return
+	}
+
+	// 输出路径冲突
+	if sub.conflict != nil && conflictPolicy == models.OnConflictFail {
+		respondJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":    "Output path conflict",
+			"conflict": sub.conflict,
+		})
+		return
+	}
+
+	if err := s.commitTask(sub, policy); err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to create task")
 		return
 	}
 
+	// 已有相同内容的任务
+	if sub.existing != nil {
+		if policy == duplicateReject {
+			respondJSON(w, http.StatusConflict, map[string]interface{}{
+				"error": "Duplicate task",
+				"task":  sub.existing,
+			})
+			return
+		}
+		respondJSON(w, http.StatusOK, sub.existing)
+		return
+	}
+
+	if sub.skip {
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"skipped":  true,
+			"conflict": sub.conflict,
+		})
+		return
+	}
+
 	respondJSON(w, http.StatusCreated, task)
 }
 
-// BatchCreateTasks 批量创建任务
-func (s *Server) BatchCreateTasks(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Directory      string          `json:"directory"`
-		Recursive      bool            `json:"recursive"`
-		Type           models.TaskType `json:"type"`
-		Params         interface{}     `json:"params"`
-		DeleteOriginal bool            `json:"deleteOriginal"`
-		OutputDir      string          `json:"outputDir"`
+// batchRequest 批量创建任务的请求体，也是定时任务保存的批量任务定义
+type batchRequest struct {
+	Directory      string              `json:"directory"`
+	Recursive      bool                `json:"recursive"`
+	Type           models.TaskType     `json:"type"`
+	Params         interface{}         `json:"params"`
+	DeleteOriginal bool                `json:"deleteOriginal"`
+	OutputDir      string              `json:"outputDir"`
+	Priority       int                 `json:"priority"`
+	RetryPolicy    *models.RetryPolicy `json:"retryPolicy"`
+	NotBefore      *time.Time          `json:"notBefore"`
+	OnDuplicate    string              `json:"onDuplicate"` // 已有相同内容的任务时跳过（reject、return）、合并（merge）或仍然创建（allow）
+	OnConflict     string              `json:"onConflict"`  // 输出路径冲突时覆盖、跳过、重命名，fail 时有任何冲突则整批不创建
+	Hooks          []models.Hook       `json:"hooks"`       // 每个任务完成或失败后执行
+	Owner          string              `json:"owner"`       // 提交者，直接提交时省略则使用 X-Owner 请求头
+	Weight         int                 `json:"weight"`      // 公平调度的权重，同一批次的任务共享
+}
+
+// batchResult 批量创建任务的结果
+type batchResult struct {
+	Count      int               `json:"count"`
+	Tasks      []*models.Task    `json:"tasks"`
+	Duplicates []*models.Task    `json:"duplicates"` // 因重复而跳过的已有任务
+	Conflicts  []*outputConflict `json:"conflicts"`  // 输出路径冲突及其处理方式
+}
+
+// validateParams 校验任务类型、参数、权重和钩子
+func (req batchRequest) validateParams() error {
+	if req.Weight < 0 {
+		return errInvalidWeight
+	}
+	paramsJSON, _ := json.Marshal(req.Params)
+	if err := processor.Validate(req.Type, string(paramsJSON)); err != nil {
+		return err
 	}
+	return worker.ValidateHooks(req.Hooks, true)
+}
+
+// errNoVideoFiles 批量任务目录中没有视频文件
+var errNoVideoFiles = errors.New("no video files found")
 
+// BatchCreateTasks 批量创建任务
+func (s *Server) BatchCreateTasks(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	req.Owner = requestOwner(r, req.Owner)
+
+	if _, err := duplicatePolicy(req.OnDuplicate); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if _, err := worker.ConflictPolicy(req.OnConflict); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := req.validateParams(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := s.createBatch(req)
+	if err != nil {
+		switch {
+		case errors.Is(err, errNoVideoFiles):
+			respondError(w, http.StatusBadRequest, "No video files found")
+		case errors.Is(err, errOutputConflict):
+			respondJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":     "Output path conflict",
+				"conflicts": result.Conflicts,
+			})
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to scan directory")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, result)
+}
+
+// RunBatch 执行保存的批量任务定义，供定时任务调用
+func (s *Server) RunBatch(definition []byte) (int, error) {
+	var req batchRequest
+	if err := json.Unmarshal(definition, &req); err != nil {
+		return 0, err
+	}
+
+	result, err := s.createBatch(req)
+	if err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
+
+// createBatch 扫描目录并为每个视频文件创建任务，同一批的任务共享一个批次 ID。
+// 先检查所有文件的重复任务和输出冲突，fail 策略下有冲突时返回 errOutputConflict，不创建任何任务
+func (s *Server) createBatch(req batchRequest) (*batchResult, error) {
+	result := &batchResult{
+		Tasks:      []*models.Task{},
+		Duplicates: []*models.Task{},
+		Conflicts:  []*outputConflict{},
+	}
+
+	policy, err := duplicatePolicy(req.OnDuplicate)
+	if err != nil {
+		return result, err
+	}
+	conflictPolicy, err := worker.ConflictPolicy(req.OnConflict)
+	if err != nil {
+		return result, err
+	}
+	if err := req.validateParams(); err != nil {
+		return result, err
+	}
 
 	// 查找所有视频文件
 	videoFiles, err := findVideoFiles(req.Directory, req.Recursive)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to scan directory")
-		return
+		return result, fmt.Errorf("failed to scan directory: %w", err)
 	}
 
 	if len(videoFiles) == 0 {
-		respondError(w, http.StatusBadRequest, "No video files found")
-		return
+		return result, errNoVideoFiles
 	}
 
 	paramsJSON, _ := json.Marshal(req.Params)
 
-	var createdTasks []*models.Task
+	s.submitMu.Lock()
+	defer s.submitMu.Unlock()
+
+	idx := s.newOutputIndex()
+	batchID := newBatchID()
+	var subs []*submission
 	for _, videoFile := range videoFiles {
-		outputPath := generateOutputPath(videoFile, req.Type, req.OutputDir, req.Params)
+		outputPath := generateOutputPath(videoFile, req.Type, req.OutputDir, string(paramsJSON))
 
 		task := &models.Task{
 			InputPath:      videoFile,
@@ -186,21 +375,51 @@ func (s *Server) BatchCreateTasks(w http.ResponseWriter, r *http.Request) {
 			Type:           req.Type,
 			Params:         string(paramsJSON),
 			DeleteOriginal: req.DeleteOriginal,
+			Priority:       req.Priority,
+			RetryPolicy:    req.RetryPolicy,
+			NotBefore:      req.NotBefore,
+			Hooks:          req.Hooks,
+			Owner:          req.Owner,
+			BatchID:        batchID,
+			Weight:         req.Weight,
 			Status:         models.TaskStatusPending,
 		}
 
-		if err := s.queue.AddTask(task); err != nil {
+		info, err := os.Stat(videoFile)
+		if err != nil {
+			log.Printf("Failed to stat %s: %v", videoFile, err)
+		}
+
+		sub, err := s.planTask(task, info, policy, conflictPolicy, idx)
+		if err != nil {
 			log.Printf("Failed to add task for %s: %v", videoFile, err)
 			continue
 		}
+		if sub.conflict != nil {
+			result.Conflicts = append(result.Conflicts, sub.conflict)
+		}
+		subs = append(subs, sub)
+	}
 
-		createdTasks = append(createdTasks, task)
+	if conflictPolicy == models.OnConflictFail && len(result.Conflicts) > 0 {
+		return result, errOutputConflict
 	}
 
-	respondJSON(w, http.StatusCreated, map[string]interface{}{
-		"count": len(createdTasks),
-		"tasks": createdTasks,
-	})
+	for _, sub := range subs {
+		if err := s.commitTask(sub, policy); err != nil {
+			log.Printf("Failed to add task for %s: %v", sub.task.InputPath, err)
+			continue
+		}
+		switch {
+		case sub.existing != nil:
+			result.Duplicates = append(result.Duplicates, sub.existing)
+		case !sub.skip:
+			result.Tasks = append(result.Tasks, sub.task)
+		}
+	}
+	result.Count = len(result.Tasks)
+
+	return result, nil
 }
 
 // GetTasks 获取所有任务
@@ -216,8 +435,7 @@ func (s *Server) GetTasks(w http.ResponseWriter, r *http.Request) {
 
 // GetTask 获取单个任务
 func (s *Server) GetTask(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/tasks/")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := parseTaskID(r.URL.Path)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid task ID")
 		return
@@ -232,10 +450,207 @@ func (s *Server) GetTask(w http.ResponseWriter, r *http.Request) {
 	respondJSON(w, http.StatusOK, task)
 }
 
+// GetTaskHooks 获取任务钩子的执行记录，包括输出和退出状态
+func (s *Server) GetTaskHooks(w http.ResponseWriter, r *http.Request) {
+	id, err := parseTaskID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	if _, err := s.db.GetTask(id); err != nil {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+
+	runs, err := s.db.GetHookRuns(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get hook runs")
+		return
+	}
+	respondJSON(w, http.StatusOK, runs)
+}
+
+// GetTaskEvents 获取任务的生命周期事件，按发生顺序排列
+func (s *Server) GetTaskEvents(w http.ResponseWriter, r *http.Request) {
+	id, err := parseTaskID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	if _, err := s.db.GetTask(id); err != nil {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+
+	events, err := s.db.GetTaskEvents(id)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get task events")
+		return
+	}
+	respondJSON(w, http.StatusOK, events)
+}
+
+// MoveTask 调整等待中任务在队列中的位置
+// 请求体: {"to": "front"} / {"to": "back"} / {"position": 3}（从 1 开始）
+func (s *Server) MoveTask(w http.ResponseWriter, r *http.Request) {
+	id, err := parseTaskID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	var req struct {
+		To       string `json:"to"`
+		Position int    `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var position int
+	switch {
+	case req.To == "front":
+		position = 0
+	case req.To == "back":
+		position = -1
+	case req.To == "" && req.Position > 0:
+		position = req.Position - 1
+	default:
+		respondError(w, http.StatusBadRequest, "Either to (front/back) or a positive position is required")
+		return
+	}
+
+	if err := s.queue.MoveTask(id, position); err != nil {
+		if errors.Is(err, worker.ErrTaskNotQueued) {
+			respondError(w, http.StatusConflict, "Task is not waiting in queue")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to move task")
+		return
+	}
+
+	task, err := s.db.GetTask(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, task)
+}
+
+// PauseTask 暂停任务
+func (s *Server) PauseTask(w http.ResponseWriter, r *http.Request) {
+	s.setTaskPaused(w, r, true)
+}
+
+// ResumeTask 恢复已暂停的任务
+func (s *Server) ResumeTask(w http.ResponseWriter, r *http.Request) {
+	s.setTaskPaused(w, r, false)
+}
+
+func (s *Server) setTaskPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	id, err := parseTaskID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	if paused {
+		err = s.queue.PauseTask(id)
+	} else {
+		err = s.queue.ResumeTask(id)
+	}
+	if err != nil {
+		if errors.Is(err, worker.ErrTaskNotActive) {
+			respondError(w, http.StatusConflict, "Task is not queued or running")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	task, err := s.db.GetTask(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, task)
+}
+
+// CancelTask 取消任务，保留任务记录、日志和临时输出，请求体可选 {"reason": "..."}
+func (s *Server) CancelTask(w http.ResponseWriter, r *http.Request) {
+	id, err := parseTaskID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	if err := s.queue.Cancel(id, req.Reason); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			respondError(w, http.StatusNotFound, "Task not found")
+		case errors.Is(err, worker.ErrTaskNotActive):
+			respondError(w, http.StatusConflict, "Task is not queued or running")
+		default:
+			respondError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	task, err := s.db.GetTask(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, task)
+}
+
+// GetTaskTypes 返回已注册的任务类型及其参数定义，界面据此生成参数表单
+func (s *Server) GetTaskTypes(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, processor.List())
+}
+
+// GetQueueState 获取队列状态
+func (s *Server) GetQueueState(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, s.queue.State())
+}
+
+// PauseQueue 全局暂停队列，不再启动新任务
+func (s *Server) PauseQueue(w http.ResponseWriter, r *http.Request) {
+	if err := s.queue.PauseQueue(); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to pause queue")
+		return
+	}
+	respondJSON(w, http.StatusOK, s.queue.State())
+}
+
+// ResumeQueue 恢复队列调度
+func (s *Server) ResumeQueue(w http.ResponseWriter, r *http.Request) {
+	if err := s.queue.ResumeQueue(); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to resume queue")
+		return
+	}
+	respondJSON(w, http.StatusOK, s.queue.State())
+}
+
 // DeleteTask 删除任务
 func (s *Server) DeleteTask(w http.ResponseWriter, r *http.Request) {
-	idStr := strings.TrimPrefix(r.URL.Path, "/api/tasks/")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := parseTaskID(r.URL.Path)
 	if err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid task ID")
 		return
@@ -256,9 +671,17 @@ func (s *Server) DeleteTask(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Failed to cancel task %d: %v", id, cancelErr)
 	}
 
+	// 依赖该任务的下游任务无法再执行
+	s.queue.CancelDependents(id, fmt.Sprintf("upstream task %d deleted", id))
+
 	// 等待一小段时间，确保进程已完全终止并释放文件句柄
 	time.Sleep(100 * time.Millisecond)
 
+	// 取消时保留的临时输出和分段工作目录随任务一起删除
+	if task != nil {
+		s.queue.DiscardTaskFiles(task)
+	}
+
 	// 根据参数决定是否删除输出文件
 	if deleteOutput && task != nil && task.OutputPath != "" {
 		if err := os.RemoveAll(task.OutputPath); err != nil {
@@ -272,6 +695,7 @@ func (s *Server) DeleteTask(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusInternalServerError, "Failed to delete task")
 		return
 	}
+	s.queue.ForgetCanceled(id)
 
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Task deleted"})
 }
@@ -306,6 +730,15 @@ func respondError(w http.ResponseWriter, status int, message string) {
 	respondJSON(w, status, map[string]string{"error": message})
 }
 
+// parseTaskID 从 /api/tasks/{id} 或 /api/tasks/{id}/{action} 路径中解析任务 ID
+func parseTaskID(path string) (int64, error) {
+	idStr := strings.TrimPrefix(path, "/api/tasks/")
+	if i := strings.Index(idStr, "/"); i >= 0 {
+		idStr = idStr[:i]
+	}
+	return strconv.ParseInt(idStr, 10, 64)
+}
+
 func findVideoFiles(directory string, recursive bool) ([]string, error) {
 	var videoFiles []string
 
@@ -339,52 +772,15 @@ func findVideoFiles(directory string, recursive bool) ([]string, error) {
 	return videoFiles, nil
 }
 
-func generateOutputPath(inputPath string, taskType models.TaskType, outputDir string, params interface{}) string {
-	baseName := filepath.Base(inputPath)
-	nameWithoutExt := strings.TrimSuffix(baseName, filepath.Ext(baseName))
-
-	// 尝试从参数中解析 outputExtension（目前只在 remux 中使用）
-	var outputExtFromParams string
-	if params != nil {
-		if m, ok := params.(map[string]interface{}); ok {
-			if v, ok := m["outputExtension"]; ok {
-				if s, ok := v.(string); ok && s != "" {
-					if !strings.HasPrefix(s, ".") {
-						outputExtFromParams = "." + s
-					} else {
-						outputExtFromParams = s
-					}
-				}
-			}
-		}
-	}
-
-	var ext string
-
-	switch taskType {
-	case models.TaskTypeTranscode:
-		ext = ".mp4"
-	case models.TaskTypeRemux:
-		if outputExtFromParams != "" {
-			ext = outputExtFromParams
-		} else {
-			ext = ".mp4"
-		}
-	case models.TaskTypeTrim:
-		ext = filepath.Ext(baseName)
-	case models.TaskTypeThumbnail:
-		ext = "" // 缩略图目录
-	default:
-		ext = filepath.Ext(baseName)
-	}
-
+// generateOutputPath 由任务类型的处理器推导默认输出路径，未注册的类型保留原文件名
+func generateOutputPath(inputPath string, taskType models.TaskType, outputDir string, paramsJSON string) string {
 	if outputDir == "" {
 		outputDir = config.GlobalConfig.FFmpeg.DefaultOutputDir
 	}
 
-	if taskType == models.TaskTypeThumbnail {
-		return filepath.Join(outputDir, nameWithoutExt+"_thumbs")
+	p, err := processor.Get(taskType)
+	if err != nil {
+		return filepath.Join(outputDir, filepath.Base(inputPath))
 	}
-
-	return filepath.Join(outputDir, nameWithoutExt+ext)
+	return p.OutputPath(inputPath, outputDir, paramsJSON)
 }
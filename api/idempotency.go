@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+	"videoforge/database"
+)
+
+// idempotencyTTL Idempotency-Key 的有效期
+const idempotencyTTL = 24 * time.Hour
+
+// Idempotent 支持 Idempotency-Key 请求头：有效期内相同的 key 直接返回第一次成功请求的响应，
+// 不会重复创建任务；同一个 key 用于不同的请求时返回 422
+func (s *Server) Idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		h := sha256.New()
+		io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+		h.Write(body)
+		requestHash := hex.EncodeToString(h.Sum(nil))
+
+		// 同一个 key 的并发请求只执行一次，不同 key 的请求互不等待
+		unlock := s.idempotencyMu.Lock(key)
+		defer unlock()
+
+		saved, err := s.db.GetIdempotentResponse(key, time.Now().Add(-idempotencyTTL))
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, "Failed to check idempotency key")
+			return
+		}
+		if saved != nil {
+			if saved.RequestHash != requestHash {
+				respondError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(saved.Status)
+			w.Write(saved.Body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		// 只保存成功的响应，失败的请求可以用同一个 key 重试
+		if rec.status >= 200 && rec.status < 300 {
+			resp := &database.IdempotentResponse{
+				RequestHash: requestHash,
+				Status:      rec.status,
+				Body:        rec.body.Bytes(),
+				CreatedAt:   time.Now(),
+			}
+			if err := s.db.SaveIdempotentResponse(key, resp); err != nil {
+				log.Printf("Failed to save idempotency key %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// keyedMutex 按 key 加锁，零值可用。没有请求等待的 key 会被移除
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// Lock 锁定 key，返回解锁函数
+func (m *keyedMutex) Lock(key string) func() {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*keyLock)
+	}
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyLock{}
+		m.locks[key] = l
+	}
+	l.waiters++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		if l.waiters--; l.waiters == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// responseRecorder 在写出响应的同时记录状态码和响应体
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"videoforge/ffmpeg"
+	"videoforge/models"
+	"videoforge/worker"
+)
+
+// logFollowInterval follow 模式下检查日志新内容的间隔
+const logFollowInterval = 500 * time.Millisecond
+
+// GetTaskLog 获取任务的 FFmpeg 日志（纯文本），包括每次执行的命令行和完整的 stderr。
+// tail=N 只返回最后 N 行；follow=true 时持续输出新写入的内容，直到任务结束或客户端断开
+func (s *Server) GetTaskLog(w http.ResponseWriter, r *http.Request) {
+	id, err := parseTaskID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid task ID")
+		return
+	}
+
+	task, err := s.db.GetTask(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+
+	tail := 0
+	if v := r.URL.Query().Get("tail"); v != "" {
+		if tail, err = strconv.Atoi(v); err != nil || tail <= 0 {
+			respondError(w, http.StatusBadRequest, "tail must be a positive number")
+			return
+		}
+	}
+	follow := r.URL.Query().Get("follow") == "true" || r.URL.Query().Get("follow") == "1"
+
+	path := worker.TaskLogPath(id)
+	contents, err := readLogFiles(ffmpeg.LogFiles(path, worker.TaskLogBackups()))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to read task log")
+		return
+	}
+	if len(contents) == 0 && !follow {
+		if task.WorkerID != "" {
+			respondError(w, http.StatusNotFound, "Log is kept on remote worker "+task.WorkerID)
+			return
+		}
+		respondError(w, http.StatusNotFound, "No log for this task")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	data := bytes.Join(contents, nil)
+	if tail > 0 {
+		data = tailLines(data, tail)
+	}
+	w.Write(data)
+	if !follow {
+		return
+	}
+
+	// 当前日志文件已输出到的位置，轮转后从新文件开头继续
+	var offset int64
+	if info, err := os.Stat(path); err == nil && len(contents) > 0 {
+		offset = int64(len(contents[len(contents)-1]))
+		if info.Size() < offset {
+			offset = 0
+		}
+	}
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	ticker := time.NewTicker(logFollowInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		// 先检查任务状态再读取，任务结束前写入的内容不会漏掉
+		current, err := s.db.GetTask(id)
+		active := err == nil && taskActive(current.Status)
+
+		n, err := copyLogFrom(w, path, offset)
+		if err == errLogRotated {
+			offset = 0
+			n, err = copyLogFrom(w, path, 0)
+		}
+		offset += n
+		if n > 0 && flusher != nil {
+			flusher.Flush()
+		}
+		if !active && n == 0 {
+			return
+		}
+	}
+}
+
+// taskActive 任务是否还可能执行、写入新的日志
+func taskActive(status models.TaskStatus) bool {
+	switch status {
+	case models.TaskStatusPending, models.TaskStatusRunning, models.TaskStatusPaused,
+		models.TaskStatusInterrupted, models.TaskStatusWaitingRes:
+		return true
+	}
+	return false
+}
+
+// readLogFiles 按顺序读取日志文件，读取期间被轮转删除的文件跳过
+func readLogFiles(files []string) ([][]byte, error) {
+	var contents [][]byte
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, data)
+	}
+	return contents, nil
+}
+
+// tailLines 返回 data 的最后 n 行
+func tailLines(data []byte, n int) []byte {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+	}
+	for i := end - 1; i >= 0; i-- {
+		if data[i] == '\n' {
+			n--
+			if n == 0 {
+				return data[i+1:]
+			}
+		}
+	}
+	return data
+}
+
+// errLogRotated 日志文件比已读取的位置短，说明已经轮转
+var errLogRotated = errors.New("log rotated")
+
+// copyLogFrom 把日志文件 offset 之后的内容写入 w，返回写入的字节数
+func copyLogFrom(w io.Writer, path string, offset int64) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() < offset {
+		return 0, errLogRotated
+	}
+	if info.Size() == offset {
+		return 0, nil
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.CopyN(w, f, info.Size()-offset)
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"videoforge/models"
+	"videoforge/processor"
+	"videoforge/worker"
+)
+
+// PipelineStep 流水线中的一个步骤
+type PipelineStep struct {
+	Name       string          `json:"name"`
+	Type       models.TaskType `json:"type"`
+	Params     interface{}     `json:"params"`
+	OutputPath string          `json:"outputPath"`
+	Hooks      []models.Hook   `json:"hooks"`      // 该步骤完成或失败后执行
+	OnConflict string          `json:"onConflict"` // 输出路径冲突策略，省略时使用流水线的设置
+	// DependsOn 依赖的步骤名称；省略时依赖上一个步骤，空数组表示直接处理原始输入
+	DependsOn []string `json:"dependsOn"`
+}
+
+// CreatePipeline 创建多步骤流水线，例如 裁剪 → 转码 → 缩略图。
+// 每个步骤以第一个上游步骤的输出作为输入，上游全部完成后才会执行，上游失败时下游自动取消。
+// 与批量任务一样先检查所有步骤的输出冲突（包括步骤之间），fail 策略下有冲突时不创建任何步骤
+func (s *Server) CreatePipeline(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		InputPath   string              `json:"inputPath"`
+		OutputDir   string              `json:"outputDir"`
+		Priority    int                 `json:"priority"`
+		RetryPolicy *models.RetryPolicy `json:"retryPolicy"`
+		NotBefore   *time.Time          `json:"notBefore"`
+		Steps       []PipelineStep      `json:"steps"`
+		Owner       string              `json:"owner"`      // 提交者，省略时使用 X-Owner 请求头
+		Weight      int                 `json:"weight"`     // 公平调度的权重
+		OnConflict  string              `json:"onConflict"` // overwrite、skip、rename、fail
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if _, err := os.Stat(req.InputPath); err != nil {
+		respondError(w, http.StatusBadRequest, "Input file not found")
+		return
+	}
+
+	if err := validatePipeline(req.Steps); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Weight < 0 {
+		respondError(w, http.StatusBadRequest, errInvalidWeight.Error())
+		return
+	}
+	conflictPolicy, err := worker.ConflictPolicy(req.OnConflict)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 流水线的所有步骤属于同一个批次
+	owner := requestOwner(r, req.Owner)
+	batchID := newBatchID()
+
+	baseName := filepath.Base(req.InputPath)
+	ext := filepath.Ext(baseName)
+	nameWithoutExt := strings.TrimSuffix(baseName, ext)
+
+	s.submitMu.Lock()
+	defer s.submitMu.Unlock()
+
+	// 先规划所有步骤：检查输出冲突，rename 策略下改写输出路径，下游以改写后的路径作为输入
+	idx := s.newOutputIndex()
+	subs := make(map[string]*submission, len(req.Steps))
+	deps := make([][]string, len(req.Steps))
+	conflicts := []*outputConflict{}
+	for i, step := range req.Steps {
+		dependsOn := step.DependsOn
+		if dependsOn == nil && i > 0 {
+			dependsOn = []string{req.Steps[i-1].Name}
+		}
+		deps[i] = dependsOn
+
+		// 以第一个上游步骤的输出作为输入
+		inputPath := req.InputPath
+		if len(dependsOn) > 0 {
+			inputPath = subs[dependsOn[0]].task.OutputPath
+		}
+
+		// 中间结果以步骤名区分，避免多个步骤写入同一个文件
+		paramsJSON, _ := json.Marshal(step.Params)
+
+		outputPath := step.OutputPath
+		if outputPath == "" {
+			namedInput := filepath.Join(filepath.Dir(req.InputPath), nameWithoutExt+"_"+step.Name+ext)
+			outputPath = generateOutputPath(namedInput, step.Type, req.OutputDir, string(paramsJSON))
+		}
+
+		task := &models.Task{
+			InputPath:   inputPath,
+			OutputPath:  outputPath,
+			Type:        step.Type,
+			Params:      string(paramsJSON),
+			Priority:    req.Priority,
+			RetryPolicy: req.RetryPolicy,
+			NotBefore:   req.NotBefore,
+			Hooks:       step.Hooks,
+			Owner:       owner,
+			BatchID:     batchID,
+			Weight:      req.Weight,
+			Status:      models.TaskStatusPending,
+		}
+
+		policy := conflictPolicy
+		if step.OnConflict != "" {
+			policy, _ = worker.ConflictPolicy(step.OnConflict)
+		}
+		// 中间结果尚不存在，不做重复任务检查
+		sub, err := s.planTask(task, nil, duplicateAllow, policy, idx)
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create step %s", step.Name))
+			return
+		}
+		if sub.conflict != nil {
+			conflicts = append(conflicts, sub.conflict)
+		}
+		subs[step.Name] = sub
+	}
+
+	for _, c := range conflicts {
+		if c.Action == models.OnConflictFail {
+			respondJSON(w, http.StatusConflict, map[string]interface{}{
+				"error":     "Output path conflict",
+				"conflicts": conflicts,
+			})
+			return
+		}
+	}
+
+	createdTasks := []*models.Task{}
+	for i, step := range req.Steps {
+		sub := subs[step.Name]
+
+		// 跳过的上游步骤不创建，下游改为依赖正在写入该路径的任务，输出已存在时直接使用
+		var parentIDs []int64
+		for _, name := range deps[i] {
+			parent := subs[name]
+			switch {
+			case !parent.skip:
+				parentIDs = append(parentIDs, parent.task.ID)
+			case parent.other != nil && parent.other.ID != 0:
+				parentIDs = append(parentIDs, parent.other.ID)
+			}
+		}
+		sub.task.DependsOn = parentIDs
+
+		if err := s.commitTask(sub, duplicateAllow); err != nil {
+			// 已创建的步骤无法继续，与取消接口一样取消它们。从下游开始，每个步骤都记录同一个原因
+			for j := len(createdTasks) - 1; j >= 0; j-- {
+				s.queue.Cancel(createdTasks[j].ID, "pipeline creation failed")
+			}
+			respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create step %s", step.Name))
+			return
+		}
+
+		if !sub.skip {
+			createdTasks = append(createdTasks, sub.task)
+		}
+	}
+
+	respondJSON(w, http.StatusCreated, map[string]interface{}{
+		"count":     len(createdTasks),
+		"tasks":     createdTasks,
+		"conflicts": conflicts,
+	})
+}
+
+// validatePipeline 校验步骤名唯一，且只依赖排在前面的步骤（保证无环）
+func validatePipeline(steps []PipelineStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("at least one step is required")
+	}
+
+	seen := make(map[string]bool, len(steps))
+	for _, step := range steps {
+		if step.Name == "" {
+			return fmt.Errorf("step name is required")
+		}
+		if seen[step.Name] {
+			return fmt.Errorf("duplicate step name: %s", step.Name)
+		}
+		paramsJSON, _ := json.Marshal(step.Params)
+		if err := processor.Validate(step.Type, string(paramsJSON)); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if err := worker.ValidateHooks(step.Hooks, true); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if step.OnConflict != "" {
+			if _, err := worker.ConflictPolicy(step.OnConflict); err != nil {
+				return fmt.Errorf("step %s: %w", step.Name, err)
+			}
+		}
+		for _, name := range step.DependsOn {
+			if !seen[name] {
+				return fmt.Errorf("step %s depends on unknown or later step %s", step.Name, name)
+			}
+		}
+		seen[step.Name] = true
+	}
+	return nil
+}
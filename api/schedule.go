@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"videoforge/models"
+	"videoforge/schedule"
+)
+
+// GetTimeWindows 获取队列的时间窗口配置
+func (s *Server) GetTimeWindows(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, s.queue.TimeWindows())
+}
+
+// SetTimeWindows 设置队列的时间窗口，例如 [{"types": ["transcode"], "start": "01:00", "end": "07:00"}]
+func (s *Server) SetTimeWindows(w http.ResponseWriter, r *http.Request) {
+	var windows []schedule.TimeWindow
+	if err := json.NewDecoder(r.Body).Decode(&windows); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := s.queue.SetTimeWindows(windows); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, s.queue.TimeWindows())
+}
+
+// GetSchedules 获取所有定时批量任务
+func (s *Server) GetSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := s.db.GetSchedules()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get schedules")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, schedules)
+}
+
+// CreateSchedule 创建定时批量任务，batch 与 POST /api/tasks/batch 的请求体相同
+func (s *Server) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name    string          `json:"name"`
+		Cron    string          `json:"cron"`
+		Batch   json.RawMessage `json:"batch"`
+		Enabled *bool           `json:"enabled"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if _, err := schedule.ParseCron(req.Cron); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var batch batchRequest
+	if err := json.Unmarshal(req.Batch, &batch); err != nil || batch.Directory == "" {
+		respondError(w, http.StatusBadRequest, "Invalid batch definition")
+		return
+	}
+	if err := batch.validateParams(); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sched := &models.Schedule{
+		Name:      req.Name,
+		Cron:      req.Cron,
+		Batch:     req.Batch,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+		NextRunAt: schedule.NextRun(req.Cron, time.Now()),
+	}
+
+	if err := s.db.CreateSchedule(sched); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create schedule")
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, sched)
+}
+
+// DeleteSchedule 删除定时批量任务
+func (s *Server) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/api/schedules/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid schedule ID")
+		return
+	}
+
+	if err := s.db.DeleteSchedule(id); err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to delete schedule")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Schedule deleted"})
+}
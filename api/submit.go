@@ -0,0 +1,189 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"videoforge/database"
+	"videoforge/models"
+	"videoforge/worker"
+)
+
+// errOutputConflict 输出路径冲突且策略为 fail
+var errOutputConflict = errors.New("output path conflict")
+
+// outputConflict 提交时发现的输出路径冲突
+type outputConflict struct {
+	InputPath     string `json:"inputPath"`
+	OutputPath    string `json:"outputPath"`
+	Exists        bool   `json:"exists"`                  // 输出路径上已有文件
+	TaskID        int64  `json:"taskId,omitempty"`        // 使用相同输出路径的未完成任务
+	ConflictsWith string `json:"conflictsWith,omitempty"` // 同一批次中输出路径相同的另一个输入文件
+	Action        string `json:"action"`                  // 采用的冲突策略
+	RenamedTo     string `json:"renamedTo,omitempty"`     // rename 策略下实际使用的输出路径
+}
+
+// outputIndex 检查输出路径是否被未完成任务或本次提交中已规划的任务使用。
+// 未完成任务按路径逐个查询，不加载整个队列
+type outputIndex struct {
+	db      *database.DB
+	planned map[string]*models.Task // 本次提交中已规划的任务，尚未创建时 ID 为 0
+}
+
+// newOutputIndex 创建一次提交使用的 outputIndex
+func (s *Server) newOutputIndex() *outputIndex {
+	return &outputIndex{db: s.db, planned: make(map[string]*models.Task)}
+}
+
+// lookup 返回使用 path 的任务，本次提交中已规划的任务优先，没有时返回 nil
+func (idx *outputIndex) lookup(path string) (*models.Task, error) {
+	if task, ok := idx.planned[worker.OutputKey(path)]; ok {
+		return task, nil
+	}
+	return worker.ActiveOutputTask(idx.db, path, 0)
+}
+
+func (idx *outputIndex) taken(path string) bool {
+	task, err := idx.lookup(path)
+	if err != nil {
+		log.Printf("Failed to check output path %s: %v", path, err)
+	}
+	return task != nil
+}
+
+// add 记录规划中的任务，用于发现同一次提交内的冲突
+func (idx *outputIndex) add(task *models.Task) {
+	idx.planned[worker.OutputKey(task.OutputPath)] = task
+}
+
+// check 检查任务的输出路径是否已存在或与其他任务相同，同时返回使用该路径的任务
+func (idx *outputIndex) check(task *models.Task) (*outputConflict, *models.Task, error) {
+	exists := worker.OutputExists(task.OutputPath)
+	other, err := idx.lookup(task.OutputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists && other == nil {
+		return nil, nil, nil
+	}
+
+	conflict := &outputConflict{InputPath: task.InputPath, OutputPath: task.OutputPath, Exists: exists}
+	if other != nil {
+		if other.ID != 0 {
+			conflict.TaskID = other.ID
+		} else {
+			conflict.ConflictsWith = other.InputPath
+		}
+	}
+	return conflict, other, nil
+}
+
+// GetOutputConflicts 列出输出路径相同的未完成任务
+func (s *Server) GetOutputConflicts(w http.ResponseWriter, r *http.Request) {
+	outputs, err := s.db.GetActiveOutputs()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get tasks")
+		return
+	}
+
+	type conflictGroup struct {
+		OutputPath string  `json:"outputPath"`
+		Exists     bool    `json:"exists"` // 输出路径上已有文件
+		TaskIDs    []int64 `json:"taskIds"`
+	}
+
+	groups := make(map[string]*conflictGroup)
+	var keys []string
+	for _, o := range outputs {
+		key := worker.OutputKey(o.OutputPath)
+		group, ok := groups[key]
+		if !ok {
+			group = &conflictGroup{OutputPath: o.OutputPath}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.TaskIDs = append(group.TaskIDs, o.ID)
+	}
+	sort.Strings(keys)
+
+	conflicts := []*conflictGroup{}
+	for _, key := range keys {
+		if group := groups[key]; len(group.TaskIDs) > 1 {
+			group.Exists = worker.OutputExists(group.OutputPath)
+			conflicts = append(conflicts, group)
+		}
+	}
+
+	respondJSON(w, http.StatusOK, conflicts)
+}
+
+// submission 一个待提交任务的检查结果
+type submission struct {
+	task     *models.Task
+	existing *models.Task    // 内容相同的已有任务，不再创建
+	conflict *outputConflict // 输出路径冲突
+	other    *models.Task    // 使用相同输出路径的未完成任务或同一次提交中的任务
+	skip     bool            // 输出冲突且策略为 skip，不创建
+}
+
+// planTask 检查重复任务和输出路径冲突，不做任何修改；rename 策略下直接改写任务的输出路径。
+// 调用方需持有 submitMu，idx 会记录规划中的任务，用于发现同一次提交内的冲突
+func (s *Server) planTask(task *models.Task, info os.FileInfo, dupPolicy, conflictPolicy string, idx *outputIndex) (*submission, error) {
+	sub := &submission{task: task}
+
+	if info != nil {
+		task.ContentKey = contentKey(task.InputPath, info, task.Type, task.Params)
+	}
+	if dupPolicy != duplicateAllow && task.ContentKey != "" {
+		existing, err := s.db.FindTaskByContentKey(task.ContentKey)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			sub.existing = existing
+			return sub, nil
+		}
+	}
+
+	task.OnConflict = conflictPolicy
+	conflict, other, err := idx.check(task)
+	if err != nil {
+		return nil, err
+	}
+	sub.conflict, sub.other = conflict, other
+	if sub.conflict != nil {
+		sub.conflict.Action = conflictPolicy
+		switch conflictPolicy {
+		case models.OnConflictSkip:
+			sub.skip = true
+			return sub, nil
+		case models.OnConflictRename:
+			task.OutputPath = worker.RenameOutput(task.OutputPath, idx.taken)
+			sub.conflict.RenamedTo = task.OutputPath
+		}
+	}
+
+	idx.add(task)
+	return sub, nil
+}
+
+// commitTask 创建规划好的任务；重复任务在 merge 策略下合并到已有任务
+func (s *Server) commitTask(sub *submission, dupPolicy string) error {
+	if sub.existing != nil {
+		if dupPolicy == duplicateMerge {
+			if err := s.queue.RaisePriority(sub.existing.ID, sub.task.Priority); err != nil && !errors.Is(err, worker.ErrTaskNotQueued) {
+				return err
+			}
+			if merged, err := s.db.GetTask(sub.existing.ID); err == nil {
+				sub.existing = merged
+			}
+		}
+		return nil
+	}
+	if sub.skip {
+		return nil
+	}
+	return s.queue.AddTask(sub.task)
+}
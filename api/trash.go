@@ -0,0 +1,100 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"videoforge/models"
+	"videoforge/worker"
+)
+
+// GetTrash 获取回收站记录，可按 ?taskId= 和 ?status=trashed|restored|purged 过滤
+func (s *Server) GetTrash(w http.ResponseWriter, r *http.Request) {
+	var taskID int64
+	if v := r.URL.Query().Get("taskId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid task ID")
+			return
+		}
+		taskID = id
+	}
+
+	items, err := s.db.GetTrashItems(taskID, models.TrashStatus(r.URL.Query().Get("status")))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get trash")
+		return
+	}
+	if items == nil {
+		items = []*models.TrashItem{}
+	}
+
+	respondJSON(w, http.StatusOK, items)
+}
+
+// RestoreTrash 把回收站中的原文件移回原路径
+func (s *Server) RestoreTrash(w http.ResponseWriter, r *http.Request) {
+	id, err := parseTrashID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid trash ID")
+		return
+	}
+
+	item, err := s.queue.RestoreTrash(id)
+	if err != nil {
+		respondTrashError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// PurgeTrash 永久删除回收站中的原文件
+func (s *Server) PurgeTrash(w http.ResponseWriter, r *http.Request) {
+	id, err := parseTrashID(r.URL.Path)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid trash ID")
+		return
+	}
+
+	item, err := s.queue.PurgeTrash(id)
+	if err != nil {
+		respondTrashError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, item)
+}
+
+// PurgeExpiredTrash 立即清理超过保留期限的文件
+func (s *Server) PurgeExpiredTrash(w http.ResponseWriter, r *http.Request) {
+	count, err := s.queue.PurgeExpiredTrash()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]int{"purged": count})
+}
+
+func respondTrashError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		respondError(w, http.StatusNotFound, "Trash item not found")
+	case errors.Is(err, worker.ErrNotInTrash), errors.Is(err, worker.ErrRestoreConflict):
+		respondError(w, http.StatusConflict, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// parseTrashID 从 /api/trash/{id}/{action} 路径中解析回收站记录 ID
+func parseTrashID(path string) (int64, error) {
+	idStr := strings.TrimPrefix(path, "/api/trash/")
+	if i := strings.Index(idStr, "/"); i >= 0 {
+		idStr = idStr[:i]
+	}
+	return strconv.ParseInt(idStr, 10, 64)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"os"
+	"videoforge/models"
 )
 
 type Config struct {
@@ -14,11 +15,82 @@ type Config struct {
 		Path             string `json:"path"`
 		DefaultOutputDir string `json:"defaultOutputDir"`
 		Threads          int    `json:"threads"`
+		OnConflict       string `json:"onConflict"`   // 输出路径已存在或与其他未完成任务相同时的默认处理方式：overwrite、skip、rename（默认）、fail
+		LogDir           string `json:"logDir"`       // 每个任务的 FFmpeg 日志目录，默认 ./logs
+		LogMaxSizeMB     int    `json:"logMaxSizeMB"` // 单个日志文件的最大大小（MB），超过后轮转，默认 10
+		LogBackups       int    `json:"logBackups"`   // 轮转后保留的旧日志个数，默认 2
 	} `json:"ffmpeg"`
 	Database struct {
 		Path string `json:"path"`
 	} `json:"database"`
-	VideoRootDir string `json:"videoRootDir"`
+	Worker struct {
+		Concurrency     int            `json:"concurrency"`     // 同时运行的任务总数
+		TypeConcurrency map[string]int `json:"typeConcurrency"` // 按任务类型限制并发，例如 {"thumbnail": 4, "transcode": 2}
+		Retry           struct {
+			Default models.RetryPolicy            `json:"default"` // 默认重试策略
+			Types   map[string]models.RetryPolicy `json:"types"`   // 按任务类型覆盖默认策略
+		} `json:"retry"`
+		Timeouts struct {
+			MaxRuntime   map[string]int `json:"maxRuntime"`   // 按任务类型的最长运行时间（秒），0 或未配置表示不限制
+			StallTimeout int            `json:"stallTimeout"` // 超过该秒数没有进度则判定卡死并终止，0 表示不检测
+		} `json:"timeouts"`
+		ShutdownGracePeriod int    `json:"shutdownGracePeriod"` // 停止服务时等待运行中任务结束的秒数，超时后中断并在重启时重新执行
+		WorkDir             string `json:"workDir"`             // 分段转码的临时工作目录，每个任务一个子目录
+		ChunkWorkers        int    `json:"chunkWorkers"`        // 并行分段转码同时运行的 FFmpeg 进程总数，0 表示与 concurrency 相同
+		Resources           struct {
+			MaxLoadAverage  float64 `json:"maxLoadAverage"`  // 1 分钟平均负载超过该值时不启动新任务，0 表示不检查
+			MinFreeMemoryMB int     `json:"minFreeMemoryMB"` // 可用内存低于该值（MB）时不启动新任务，0 表示不检查
+			MinFreeDiskMB   int     `json:"minFreeDiskMB"`   // 输出目录所在磁盘剩余空间低于该值（MB）时不启动该任务，0 表示不检查
+			CheckInterval   int     `json:"checkInterval"`   // 资源不足时重新检查的间隔（秒），默认 30
+		} `json:"resources"`
+		Fairness struct {
+			Mode               string         `json:"mode"`               // 同优先级任务的轮转方式：owner 按提交者，batch 按批次，为空时按提交顺序
+			Weights            map[string]int `json:"weights"`            // 提交者的权重，默认 1，权重为 2 的提交者获得两倍的执行机会
+			MaxRunningPerOwner int            `json:"maxRunningPerOwner"` // 每个提交者同时运行的任务数上限（含远程 worker），0 表示不限制
+			OwnerLimits        map[string]int `json:"ownerLimits"`        // 按提交者覆盖 maxRunningPerOwner
+		} `json:"fairness"`
+		Verify struct {
+			Enabled                  bool    `json:"enabled"`                  // 任务完成后校验输出，未通过视为失败，且不删除原文件
+			DurationTolerance        float64 `json:"durationTolerance"`        // 输出时长与预期时长允许的误差（秒）
+			DurationTolerancePercent float64 `json:"durationTolerancePercent"` // 允许的误差占预期时长的百分比，取两者中较大者
+		} `json:"verify"`
+	} `json:"worker"`
+	Dedupe struct {
+		OnDuplicate string `json:"onDuplicate"` // 请求未指定 onDuplicate 时的处理方式：allow、reject、return（默认）、merge
+	} `json:"dedupe"`
+	Trash struct {
+		Dir           string `json:"dir"`           // 删除原文件时移入的回收站目录，按原文件相对 videoRootDir 的路径存放，默认 ./trash
+		RetentionDays int    `json:"retentionDays"` // 回收站中文件的保留天数，到期后永久删除，0 表示一直保留
+		PurgeInterval int    `json:"purgeInterval"` // 清理过期文件的检查间隔（分钟），默认 60
+	} `json:"trash"`
+	Hooks struct {
+		Global               []models.Hook `json:"global"`               // 所有任务完成或失败后都执行的钩子
+		Timeout              int           `json:"timeout"`              // 钩子未设置 timeout 时的超时时间（秒），默认 60
+		AllowRequestCommands bool          `json:"allowRequestCommands"` // 是否允许通过 API 提交的钩子执行本地命令，默认只允许 HTTP 钩子
+	} `json:"hooks"`
+	Remote struct {
+		Token         string `json:"token"`         // 远程 worker 访问 /api/agent 时需要携带的令牌，为空表示不校验
+		LeaseDuration int    `json:"leaseDuration"` // 租约时长（秒），到期未续约的任务回到 pending，默认 60
+	} `json:"remote"`
+	Agent        AgentConfig `json:"agent"`
+	VideoRootDir string      `json:"videoRootDir"`
+}
+
+// AgentConfig videoforge worker 模式的配置
+type AgentConfig struct {
+	Server       string        `json:"server"`       // 中心服务器地址，例如 http://192.168.1.10:18999
+	ID           string        `json:"id"`           // worker 标识，默认使用主机名
+	Token        string        `json:"token"`        // 与服务器 remote.token 相同
+	Concurrency  int           `json:"concurrency"`  // 同时执行的任务数，默认 1
+	Types        []string      `json:"types"`        // 只领取这些类型的任务，为空表示全部
+	PollInterval int           `json:"pollInterval"` // 没有可领取的任务时的轮询间隔（秒），默认 5
+	PathMappings []PathMapping `json:"pathMappings"` // 服务器路径与本机路径的映射，为空表示两边路径相同
+}
+
+// PathMapping 共享存储在服务器和 worker 上的路径前缀
+type PathMapping struct {
+	Server string `json:"server"` // 例如 /mnt/nas
+	Local  string `json:"local"`  // 例如 Z:\nas
 }
 
 var GlobalConfig Config
@@ -2,6 +2,8 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
 	"videoforge/models"
 
@@ -12,12 +14,24 @@ type DB struct {
 	conn *sql.DB
 }
 
+// taskColumns tasks 表查询列，顺序与 scanTask 保持一致
+const taskColumns = `id, input_path, output_path, type, COALESCE(params,'') AS params, status, progress, COALESCE(error_log,'') AS error_log, COALESCE(error_code,'') AS error_code, COALESCE(waiting_reason,'') AS waiting_reason, delete_original, priority, attempts, next_attempt_at, COALESCE(retry_policy,'') AS retry_policy, not_before, pid, COALESCE(worker_id,'') AS worker_id, lease_expires_at, COALESCE(verification,'') AS verification, canceled_at, COALESCE(content_key,'') AS content_key, COALESCE(on_conflict,'') AS on_conflict, COALESCE(hooks,'') AS hooks, COALESCE(owner,'') AS owner, COALESCE(batch_id,'') AS batch_id, weight, created_at, updated_at`
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
 func NewDB(dbPath string) (*DB, error) {
 	conn, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, err
 	}
 
+	// SQLite 同一时间只允许一个写入者，多个 worker 并发更新进度时
+	// 使用单连接串行化访问，避免 "database is locked"
+	conn.SetMaxOpenConns(1)
+
 	db := &DB{conn: conn}
 	if err := db.initSchema(); err != nil {
 		return nil, err
@@ -43,28 +57,279 @@ func (db *DB) initSchema() error {
 	);
 	CREATE INDEX IF NOT EXISTS idx_status ON tasks(status);
 	
+	CREATE TABLE IF NOT EXISTS task_dependencies (
+		task_id INTEGER NOT NULL,
+		depends_on_id INTEGER NOT NULL,
+		PRIMARY KEY (task_id, depends_on_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_depends_on ON task_dependencies(depends_on_id);
+
+	CREATE TABLE IF NOT EXISTS schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		cron TEXT NOT NULL,
+		batch TEXT NOT NULL,
+		enabled INTEGER DEFAULT 1,
+		last_run_at DATETIME,
+		next_run_at DATETIME,
+		last_error TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS task_segments (
+		task_id INTEGER NOT NULL,
+		idx INTEGER NOT NULL,
+		duration REAL NOT NULL DEFAULT 0,
+		done INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (task_id, idx)
+	);
+
+	CREATE TABLE IF NOT EXISTS trash (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		original_path TEXT NOT NULL,
+		trash_path TEXT NOT NULL,
+		size INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'trashed',
+		trashed_at DATETIME NOT NULL,
+		expires_at DATETIME,
+		restored_at DATETIME,
+		purged_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_trash_task ON trash(task_id);
+
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key TEXT PRIMARY KEY,
+		request_hash TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		response TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS hook_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		name TEXT NOT NULL,
+		scope TEXT NOT NULL,
+		target TEXT NOT NULL,
+		exit_code INTEGER NOT NULL,
+		output TEXT NOT NULL,
+		error TEXT NOT NULL,
+		started_at DATETIME NOT NULL,
+		duration_ms INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_hook_runs_task ON hook_runs(task_id);
+
+	CREATE TABLE IF NOT EXISTS task_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		pid INTEGER NOT NULL,
+		host TEXT NOT NULL,
+		worker_id TEXT NOT NULL,
+		message TEXT NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_task_events_task ON task_events(task_id);
+
 	CREATE TABLE IF NOT EXISTS settings (
 		key TEXT PRIMARY KEY,
 		value TEXT NOT NULL,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 	`
-	_, err := db.conn.Exec(schema)
+	if _, err := db.conn.Exec(schema); err != nil {
+		return err
+	}
+
+	return db.migrate()
+}
+
+// migrate 为旧版本数据库补齐新增的列
+func (db *DB) migrate() error {
+	columns := []struct {
+		table, name, definition string
+	}{
+		{"tasks", "priority", "INTEGER NOT NULL DEFAULT 0"},
+		{"tasks", "attempts", "INTEGER NOT NULL DEFAULT 0"},
+		{"tasks", "next_attempt_at", "DATETIME"},
+		{"tasks", "retry_policy", "TEXT"},
+		{"tasks", "not_before", "DATETIME"},
+		{"tasks", "pid", "INTEGER NOT NULL DEFAULT 0"},
+		{"task_segments", "pid", "INTEGER NOT NULL DEFAULT 0"},
+		{"tasks", "worker_id", "TEXT"},
+		{"tasks", "lease_expires_at", "DATETIME"},
+		{"tasks", "verification", "TEXT"},
+		{"tasks", "canceled_at", "DATETIME"},
+		{"tasks", "content_key", "TEXT"},
+		{"tasks", "on_conflict", "TEXT"},
+		{"tasks", "hooks", "TEXT"},
+		{"tasks", "owner", "TEXT"},
+		{"tasks", "batch_id", "TEXT"},
+		{"tasks", "weight", "INTEGER NOT NULL DEFAULT 0"},
+		{"tasks", "error_code", "TEXT"},
+		{"tasks", "waiting_reason", "TEXT"},
+	}
+
+	for _, c := range columns {
+		if err := db.addColumnIfMissing(c.table, c.name, c.definition); err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.conn.Exec(`CREATE INDEX IF NOT EXISTS idx_content_key ON tasks(content_key)`); err != nil {
+		return err
+	}
+	// 提交和执行前按输出路径检查冲突
+	if _, err := db.conn.Exec(`CREATE INDEX IF NOT EXISTS idx_output_path ON tasks(output_path)`); err != nil {
+		return err
+	}
+	// 任务队列按状态、优先级和 ID 领取
+	_, err := db.conn.Exec(`CREATE INDEX IF NOT EXISTS idx_tasks_queue ON tasks(status, priority DESC, id)`)
+	return err
+}
+
+// addColumnIfMissing 列不存在时执行 ALTER TABLE ADD COLUMN
+func (db *DB) addColumnIfMissing(table, column, definition string) error {
+	rows, err := db.conn.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return err
+	}
+
+	exists := false
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			return err
+		}
+		if name == column {
+			exists = true
+		}
+	}
+	rows.Close()
+
+	if exists {
+		return nil
+	}
+	_, err = db.conn.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
 	return err
 }
 
+func scanTask(row rowScanner) (*models.Task, error) {
+	task := &models.Task{}
+	var nextAttemptAt, notBefore, leaseExpiresAt, canceledAt sql.NullTime
+	var retryPolicy, verification, hooks string
+	err := row.Scan(&task.ID, &task.InputPath, &task.OutputPath, &task.Type, &task.Params,
+		&task.Status, &task.Progress, &task.ErrorLog, &task.ErrorCode, &task.WaitingReason, &task.DeleteOriginal, &task.Priority,
+		&task.Attempts, &nextAttemptAt, &retryPolicy, &notBefore, &task.PID, &task.WorkerID, &leaseExpiresAt, &verification, &canceledAt, &task.ContentKey, &task.OnConflict, &hooks, &task.Owner, &task.BatchID, &task.Weight, &task.CreatedAt, &task.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if nextAttemptAt.Valid {
+		task.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if notBefore.Valid {
+		task.NotBefore = &notBefore.Time
+	}
+	if leaseExpiresAt.Valid {
+		task.LeaseExpiresAt = &leaseExpiresAt.Time
+	}
+	if canceledAt.Valid {
+		task.CanceledAt = &canceledAt.Time
+	}
+	if retryPolicy != "" {
+		task.RetryPolicy = &models.RetryPolicy{}
+		if err := json.Unmarshal([]byte(retryPolicy), task.RetryPolicy); err != nil {
+			return nil, err
+		}
+	}
+	if verification != "" {
+		task.Verification = &models.VerifyResult{}
+		if err := json.Unmarshal([]byte(verification), task.Verification); err != nil {
+			return nil, err
+		}
+	}
+	if hooks != "" {
+		if err := json.Unmarshal([]byte(hooks), &task.Hooks); err != nil {
+			return nil, err
+		}
+	}
+	return task, nil
+}
+
+func scanTasks(rows *sql.Rows) ([]*models.Task, error) {
+	defer rows.Close()
+
+	var tasks []*models.Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// CreateTask 创建任务，并在同一事务中写入任务依赖
 func (db *DB) CreateTask(task *models.Task) error {
-	result, err := db.conn.Exec(`
-		INSERT INTO tasks (input_path, output_path, type, params, status, delete_original, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`, task.InputPath, task.OutputPath, task.Type, task.Params, task.Status, task.DeleteOriginal, time.Now(), time.Now())
+	var retryPolicy interface{}
+	if task.RetryPolicy != nil {
+		data, err := json.Marshal(task.RetryPolicy)
+		if err != nil {
+			return err
+		}
+		retryPolicy = string(data)
+	}
+	var hooks interface{}
+	if len(task.Hooks) > 0 {
+		data, err := json.Marshal(task.Hooks)
+		if err != nil {
+			return err
+		}
+		hooks = string(data)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO tasks (input_path, output_path, type, params, status, delete_original, priority, retry_policy, not_before, content_key, on_conflict, hooks, owner, batch_id, weight, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, task.InputPath, task.OutputPath, task.Type, task.Params, task.Status, task.DeleteOriginal, task.Priority, retryPolicy, task.NotBefore, task.ContentKey, task.OnConflict, hooks, task.Owner, task.BatchID, task.Weight, time.Now(), time.Now())
 
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, parentID := range task.DependsOn {
+		if _, err := tx.Exec(`INSERT INTO task_dependencies (task_id, depends_on_id) VALUES (?, ?)`, id, parentID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return err
 	}
 
@@ -73,72 +338,131 @@ func (db *DB) CreateTask(task *models.Task) error {
 }
 
 func (db *DB) GetTask(id int64) (*models.Task, error) {
-	task := &models.Task{}
-	err := db.conn.QueryRow(`
-		SELECT id, input_path, output_path, type, COALESCE(params,'') AS params, status, progress, COALESCE(error_log,'') AS error_log, delete_original, created_at, updated_at
-		FROM tasks WHERE id = ?
-	`, id).Scan(&task.ID, &task.InputPath, &task.OutputPath, &task.Type, &task.Params,
-		&task.Status, &task.Progress, &task.ErrorLog, &task.DeleteOriginal, &task.CreatedAt, &task.UpdatedAt)
-
+	task, err := scanTask(db.conn.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id))
 	if err != nil {
 		return nil, err
 	}
+	if err := db.loadDependencies([]*models.Task{task}); err != nil {
+		return nil, err
+	}
 	return task, nil
 }
 
 func (db *DB) GetAllTasks() ([]*models.Task, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, input_path, output_path, type, COALESCE(params,'') AS params, status, progress, COALESCE(error_log,'') AS error_log, delete_original, created_at, updated_at
-		FROM tasks ORDER BY created_at ASC
-	`)
+	rows, err := db.conn.Query(`SELECT ` + taskColumns + ` FROM tasks ORDER BY created_at ASC`)
 	if err != nil {
 		return nil, err
 	}
+	tasks, err := scanTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, db.loadDependencies(tasks)
+}
+
+// loadDependencies 为任务填充 DependsOn
+func (db *DB) loadDependencies(tasks []*models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*models.Task, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	var rows *sql.Rows
+	var err error
+	if len(tasks) == 1 {
+		rows, err = db.conn.Query(`SELECT task_id, depends_on_id FROM task_dependencies WHERE task_id = ?`, tasks[0].ID)
+	} else {
+		rows, err = db.conn.Query(`SELECT task_id, depends_on_id FROM task_dependencies ORDER BY task_id, depends_on_id`)
+	}
+	if err != nil {
+		return err
+	}
 	defer rows.Close()
 
-	var tasks []*models.Task
 	for rows.Next() {
-		task := &models.Task{}
-		err := rows.Scan(&task.ID, &task.InputPath, &task.OutputPath, &task.Type, &task.Params,
-			&task.Status, &task.Progress, &task.ErrorLog, &task.DeleteOriginal, &task.CreatedAt, &task.UpdatedAt)
-		if err != nil {
-			return nil, err
+		var taskID, parentID int64
+		if err := rows.Scan(&taskID, &parentID); err != nil {
+			return err
+		}
+		if task, ok := byID[taskID]; ok {
+			task.DependsOn = append(task.DependsOn, parentID)
 		}
-		tasks = append(tasks, task)
 	}
-	return tasks, nil
+	return rows.Err()
 }
 
-func (db *DB) GetPendingTasks() ([]*models.Task, error) {
+// GetDependentTaskIDs 获取所有直接或间接依赖该任务、且尚未结束的下游任务
+func (db *DB) GetDependentTaskIDs(id int64) ([]int64, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, input_path, output_path, type, COALESCE(params,'') AS params, status, progress, COALESCE(error_log,'') AS error_log, delete_original, created_at, updated_at
-		FROM tasks WHERE status IN ('pending', 'running') ORDER BY created_at ASC
-	`)
+		WITH RECURSIVE downstream(id) AS (
+			SELECT task_id FROM task_dependencies WHERE depends_on_id = ?
+			UNION
+			SELECT d.task_id FROM task_dependencies d JOIN downstream ON d.depends_on_id = downstream.id
+		)
+		SELECT t.id FROM tasks t JOIN downstream ON t.id = downstream.id
+		WHERE t.status IN ('pending', 'running', 'paused', 'interrupted', 'waiting_resources')
+		ORDER BY t.id
+	`, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var tasks []*models.Task
+	var ids []int64
 	for rows.Next() {
-		task := &models.Task{}
-		err := rows.Scan(&task.ID, &task.InputPath, &task.OutputPath, &task.Type, &task.Params,
-			&task.Status, &task.Progress, &task.ErrorLog, &task.DeleteOriginal, &task.CreatedAt, &task.UpdatedAt)
-		if err != nil {
+		var taskID int64
+		if err := rows.Scan(&taskID); err != nil {
 			return nil, err
 		}
-		tasks = append(tasks, task)
+		ids = append(ids, taskID)
 	}
-	return tasks, nil
+	return ids, rows.Err()
+}
+
+// GetPendingTasks 获取未完成的任务，按优先级从高到低、同优先级按创建时间排序
+func (db *DB) GetPendingTasks() ([]*models.Task, error) {
+	rows, err := db.conn.Query(`
+		SELECT ` + taskColumns + `
+		FROM tasks WHERE status IN ('pending', 'running', 'paused', 'interrupted', 'waiting_resources') ORDER BY priority DESC, created_at ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := scanTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, db.loadDependencies(tasks)
 }
 
 func (db *DB) UpdateTaskStatus(id int64, status models.TaskStatus, progress float64, errorLog string) error {
 	_, err := db.conn.Exec(`
-		UPDATE tasks SET status = ?, progress = ?, error_log = ?, updated_at = ? WHERE id = ?
+		UPDATE tasks SET status = ?, progress = ?, error_log = ?, error_code = NULL, updated_at = ? WHERE id = ?
 	`, status, progress, errorLog, time.Now(), id)
 	return err
 }
 
+// SetTaskWaiting 把等待中的任务标记为 waiting_resources 并记录原因。
+// 只修改状态和原因，上次执行失败的 error_log、error_code 保留
+func (db *DB) SetTaskWaiting(id int64, reason string) error {
+	_, err := db.conn.Exec(`
+		UPDATE tasks SET status = ?, waiting_reason = ?, updated_at = ? WHERE id = ? AND status IN (?, ?)
+	`, models.TaskStatusWaitingRes, reason, time.Now(), id, models.TaskStatusPending, models.TaskStatusWaitingRes)
+	return err
+}
+
+// SetTaskFailed 任务最终失败，记录错误信息和错误码
+func (db *DB) SetTaskFailed(id int64, progress float64, errorLog, errorCode string) error {
+	_, err := db.conn.Exec(`
+		UPDATE tasks SET status = ?, progress = ?, error_log = ?, error_code = ?, updated_at = ? WHERE id = ?
+	`, models.TaskStatusError, progress, errorLog, errorCode, time.Now(), id)
+	return err
+}
+
 func (db *DB) UpdateTaskProgress(id int64, progress float64) error {
 	_, err := db.conn.Exec(`
 		UPDATE tasks SET progress = ?, updated_at = ? WHERE id = ?
@@ -146,11 +470,136 @@ func (db *DB) UpdateTaskProgress(id int64, progress float64) error {
 	return err
 }
 
-func (db *DB) DeleteTask(id int64) error {
-	_, err := db.conn.Exec(`DELETE FROM tasks WHERE id = ?`, id)
+// IncrementTaskAttempts 任务开始执行时累加执行次数，并清除重试等待时间
+func (db *DB) IncrementTaskAttempts(id int64) error {
+	_, err := db.conn.Exec(`
+		UPDATE tasks SET attempts = attempts + 1, next_attempt_at = NULL, updated_at = ? WHERE id = ?
+	`, time.Now(), id)
 	return err
 }
 
+// ScheduleTaskRetry 将失败的任务重置为 pending，并记录下次重试时间、本次错误和错误码
+func (db *DB) ScheduleTaskRetry(id int64, nextAttemptAt time.Time, errorLog, errorCode string) error {
+	_, err := db.conn.Exec(`
+		UPDATE tasks SET status = ?, progress = 0, error_log = ?, error_code = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?
+	`, models.TaskStatusPending, errorLog, errorCode, nextAttemptAt, time.Now(), id)
+	return err
+}
+
+// SetTaskPID 记录任务正在运行的 FFmpeg 进程号，进程结束后置 0
+func (db *DB) SetTaskPID(id int64, pid int) error {
+	_, err := db.conn.Exec(`UPDATE tasks SET pid = ? WHERE id = ?`, pid, id)
+	return err
+}
+
+// SetTaskVerification 记录输出校验结果
+func (db *DB) SetTaskVerification(id int64, result *models.VerifyResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = db.conn.Exec(`UPDATE tasks SET verification = ? WHERE id = ?`, string(data), id)
+	return err
+}
+
+// SetTaskLease 记录领取任务的远程 worker 和租约到期时间，workerID 为空表示清除租约
+func (db *DB) SetTaskLease(id int64, workerID string, expiresAt *time.Time) error {
+	_, err := db.conn.Exec(`UPDATE tasks SET worker_id = ?, lease_expires_at = ? WHERE id = ?`, workerID, expiresAt, id)
+	return err
+}
+
+// SetTaskStatus 只更新任务状态，保留进度和错误信息
+func (db *DB) SetTaskStatus(id int64, status models.TaskStatus) error {
+	_, err := db.conn.Exec(`
+		UPDATE tasks SET status = ?, updated_at = ? WHERE id = ?
+	`, status, time.Now(), id)
+	return err
+}
+
+// UpdateTaskOutputPath 修改任务的输出路径，并同步修改以该输出作为输入的下游任务
+func (db *DB) UpdateTaskOutputPath(id int64, oldPath, newPath string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE tasks SET output_path = ?, updated_at = ? WHERE id = ?`, newPath, time.Now(), id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`
+		UPDATE tasks SET input_path = ?, updated_at = ?
+		WHERE input_path = ? AND id IN (SELECT task_id FROM task_dependencies WHERE depends_on_id = ?)
+	`, newPath, time.Now(), oldPath, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetTaskCanceled 将任务标记为已取消。canceled_at 一经写入不会被清除，
+// 即使之后状态被运行中的进程覆盖，重启时也不会重新执行该任务
+func (db *DB) SetTaskCanceled(id int64, reason string) error {
+	now := time.Now()
+	_, err := db.conn.Exec(`
+		UPDATE tasks SET status = ?, error_log = ?, waiting_reason = NULL, canceled_at = COALESCE(canceled_at, ?), updated_at = ? WHERE id = ?
+	`, models.TaskStatusCanceled, reason, now, now, id)
+	return err
+}
+
+// UpdateTaskPriorities 在一个事务中批量更新任务优先级
+func (db *DB) UpdateTaskPriorities(priorities map[int64]int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	for id, priority := range priorities {
+		if _, err := tx.Exec(`UPDATE tasks SET priority = ?, updated_at = ? WHERE id = ?`, priority, time.Now(), id); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteTask 删除任务及其记录。依赖该任务、仍在队列中的下游任务无法再执行，
+// 在同一个事务中标记为已取消，并删除两个方向的依赖关系
+func (db *DB) DeleteTask(id int64) error {
+	if err := db.DeleteTaskSegments(id); err != nil {
+		return err
+	}
+	if err := db.DeleteHookRuns(id); err != nil {
+		return err
+	}
+	if err := db.DeleteTaskEvents(id); err != nil {
+		return err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if _, err := tx.Exec(`
+		UPDATE tasks SET status = ?, error_log = ?, canceled_at = COALESCE(canceled_at, ?), updated_at = ?
+		WHERE status IN ('pending', 'waiting_resources', 'paused', 'interrupted')
+			AND id IN (SELECT task_id FROM task_dependencies WHERE depends_on_id = ?)
+	`, models.TaskStatusCanceled, fmt.Sprintf("upstream task %d deleted", id), now, now, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM task_dependencies WHERE task_id = ? OR depends_on_id = ?`, id, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM tasks WHERE id = ?`, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"videoforge/models"
+)
+
+// FindTaskByContentKey 查找内容键相同、未失败也未取消的最新任务，不存在时返回 nil
+func (db *DB) FindTaskByContentKey(key string) (*models.Task, error) {
+	row := db.conn.QueryRow(`
+		SELECT `+taskColumns+` FROM tasks
+		WHERE content_key = ? AND status NOT IN (?, ?)
+		ORDER BY id DESC LIMIT 1
+	`, key, models.TaskStatusError, models.TaskStatusCanceled)
+	task, err := scanTask(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return task, err
+}
+
+// IdempotentResponse 以 Idempotency-Key 保存的响应
+type IdempotentResponse struct {
+	RequestHash string
+	Status      int
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// GetIdempotentResponse 获取 since 之后保存的响应，不存在时返回 nil，并清理更早的记录。
+// 时间可能带有不同的时区，用 julianday 比较
+func (db *DB) GetIdempotentResponse(key string, since time.Time) (*IdempotentResponse, error) {
+	if _, err := db.conn.Exec(`DELETE FROM idempotency_keys WHERE julianday(created_at) < julianday(?)`, since); err != nil {
+		return nil, err
+	}
+
+	resp := &IdempotentResponse{}
+	var body string
+	err := db.conn.QueryRow(`
+		SELECT request_hash, status, response, created_at FROM idempotency_keys WHERE key = ?
+	`, key).Scan(&resp.RequestHash, &resp.Status, &body, &resp.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = []byte(body)
+	return resp, nil
+}
+
+// SaveIdempotentResponse 保存请求的响应，同一个 key 在有效期内重复请求时直接返回
+func (db *DB) SaveIdempotentResponse(key string, resp *IdempotentResponse) error {
+	_, err := db.conn.Exec(`
+		INSERT OR REPLACE INTO idempotency_keys (key, request_hash, status, response, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, key, resp.RequestHash, resp.Status, string(resp.Body), resp.CreatedAt)
+	return err
+}
@@ -0,0 +1,50 @@
+package database
+
+import "videoforge/models"
+
+// CreateTaskEvent 追加一条任务事件
+func (db *DB) CreateTaskEvent(event *models.TaskEvent) error {
+	result, err := db.conn.Exec(`
+		INSERT INTO task_events (task_id, event, attempt, pid, host, worker_id, message, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, event.TaskID, event.Event, event.Attempt, event.PID, event.Host, event.WorkerID, event.Message, event.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	event.ID = id
+	return nil
+}
+
+// GetTaskEvents 按发生顺序获取任务的事件
+func (db *DB) GetTaskEvents(taskID int64) ([]*models.TaskEvent, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, task_id, event, attempt, pid, host, worker_id, message, created_at
+		FROM task_events WHERE task_id = ? ORDER BY id ASC
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*models.TaskEvent{}
+	for rows.Next() {
+		event := &models.TaskEvent{}
+		if err := rows.Scan(&event.ID, &event.TaskID, &event.Event, &event.Attempt, &event.PID,
+			&event.Host, &event.WorkerID, &event.Message, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// DeleteTaskEvents 删除任务的事件
+func (db *DB) DeleteTaskEvents(taskID int64) error {
+	_, err := db.conn.Exec(`DELETE FROM task_events WHERE task_id = ?`, taskID)
+	return err
+}
@@ -0,0 +1,50 @@
+package database
+
+import "videoforge/models"
+
+// CreateHookRun 记录一次钩子执行的结果
+func (db *DB) CreateHookRun(run *models.HookRun) error {
+	result, err := db.conn.Exec(`
+		INSERT INTO hook_runs (task_id, event, name, scope, target, exit_code, output, error, started_at, duration_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, run.TaskID, run.Event, run.Name, run.Scope, run.Target, run.ExitCode, run.Output, run.Error, run.StartedAt, run.DurationMs)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	run.ID = id
+	return nil
+}
+
+// GetHookRuns 按执行顺序获取任务的钩子执行记录
+func (db *DB) GetHookRuns(taskID int64) ([]*models.HookRun, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, task_id, event, name, scope, target, exit_code, output, error, started_at, duration_ms
+		FROM hook_runs WHERE task_id = ? ORDER BY id ASC
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*models.HookRun{}
+	for rows.Next() {
+		run := &models.HookRun{}
+		if err := rows.Scan(&run.ID, &run.TaskID, &run.Event, &run.Name, &run.Scope, &run.Target,
+			&run.ExitCode, &run.Output, &run.Error, &run.StartedAt, &run.DurationMs); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// DeleteHookRuns 删除任务的钩子执行记录
+func (db *DB) DeleteHookRuns(taskID int64) error {
+	_, err := db.conn.Exec(`DELETE FROM hook_runs WHERE task_id = ?`, taskID)
+	return err
+}
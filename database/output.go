@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"videoforge/models"
+)
+
+// activeCondition 未结束的任务，与 GetPendingTasks 一致
+const activeCondition = `status IN ('pending', 'running', 'paused', 'interrupted', 'waiting_resources')`
+
+// GetActiveTaskByOutput 查找输出路径为 paths 之一的未结束任务，排除 exclude，不存在时返回 nil。
+// 同一个输出路径可能以相对或绝对路径保存，调用方传入需要比较的所有写法
+func (db *DB) GetActiveTaskByOutput(paths []string, exclude int64) (*models.Task, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, 0, len(paths)+1)
+	for _, p := range paths {
+		args = append(args, p)
+	}
+	args = append(args, exclude)
+
+	row := db.conn.QueryRow(`
+		SELECT `+taskColumns+` FROM tasks
+		WHERE output_path IN (?`+strings.Repeat(`, ?`, len(paths)-1)+`) AND id != ? AND `+activeCondition+`
+		ORDER BY id ASC LIMIT 1
+	`, args...)
+	task, err := scanTask(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return task, err
+}
+
+// TaskOutput 未结束任务的输出路径
+type TaskOutput struct {
+	ID         int64
+	OutputPath string
+}
+
+// GetActiveOutputs 按 ID 顺序返回所有未结束任务的输出路径，只读取这两列
+func (db *DB) GetActiveOutputs() ([]TaskOutput, error) {
+	rows, err := db.conn.Query(`SELECT id, output_path FROM tasks WHERE ` + activeCondition + ` ORDER BY id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var outputs []TaskOutput
+	for rows.Next() {
+		var o TaskOutput
+		if err := rows.Scan(&o.ID, &o.OutputPath); err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, o)
+	}
+	return outputs, rows.Err()
+}
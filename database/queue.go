@@ -0,0 +1,303 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"time"
+	"videoforge/models"
+)
+
+// tasks 表即任务队列。queuedCondition 为仍在队列中的任务（含已暂停的），
+// claimableCondition 为其中可以被领取的任务
+const (
+	queuedCondition    = `status IN ('pending', 'waiting_resources', 'paused') AND canceled_at IS NULL AND COALESCE(worker_id, '') = ''`
+	claimableCondition = `status IN ('pending', 'waiting_resources') AND canceled_at IS NULL AND COALESCE(worker_id, '') = ''`
+)
+
+// readyCondition 可领取且已到 notBefore 和重试时间、上游任务全部完成。
+// 时间可能带有不同的时区，用 julianday 比较
+const readyCondition = claimableCondition + `
+	AND (not_before IS NULL OR julianday(not_before) <= julianday(?))
+	AND (next_attempt_at IS NULL OR julianday(next_attempt_at) <= julianday(?))
+	AND NOT EXISTS (
+		SELECT 1 FROM task_dependencies d LEFT JOIN tasks p ON p.id = d.depends_on_id
+		WHERE d.task_id = tasks.id AND (p.status IS NULL OR p.status NOT IN ('finished', 'skipped'))
+	)`
+
+// QueueCursor 队列中的位置，用于分批读取。队列按优先级从高到低、同优先级按 ID 排序
+type QueueCursor struct {
+	Priority int
+	ID       int64
+}
+
+// QueueEntry 等待队列中的任务，用于调整顺序和估算排队位置
+type QueueEntry struct {
+	ID       int64
+	Priority int
+	Status   models.TaskStatus
+	Type     models.TaskType
+	Owner    string
+	BatchID  string
+	Weight   int
+}
+
+// ReadyFilter 领取任务时限定或排除的任务类型、提交者、路径和任务
+type ReadyFilter struct {
+	Types          []models.TaskType // 不为空时只返回这些类型的任务
+	PathPrefixes   []string          // 不为空时输入和输出路径都必须位于其中某个目录下
+	ExcludeChunked bool              // 排除分段转码任务
+	ExcludeTypes   []models.TaskType
+	ExcludeOwners  []string
+	ExcludeIDs     []int64
+	ExcludeDirs    []string // 输出路径位于这些目录下的任务，例如所在磁盘空间不足
+}
+
+// chunkedCondition 分段转码任务，与 ffmpeg.TranscodeParams.IsChunked 一致
+const chunkedCondition = `(type = 'transcode' AND CASE WHEN json_valid(params) THEN
+	json_extract(params, '$.chunked') = 1 OR COALESCE(json_extract(params, '$.parallel'), 0) > 1 ELSE 0 END)`
+
+// pathUnderCond 路径列 column 等于 dir 或位于 dir 目录下的条件及其参数
+func pathUnderCond(column, dir string) (string, []interface{}) {
+	sep := string(filepath.Separator)
+	return `(` + column + ` = ? OR instr(` + column + `, ?) = 1)`, []interface{}{dir, strings.TrimSuffix(dir, sep) + sep}
+}
+
+// where 返回附加在 readyCondition 之后的条件及其参数
+func (f ReadyFilter) where() (string, []interface{}) {
+	var sb strings.Builder
+	var args []interface{}
+	if len(f.Types) > 0 {
+		sb.WriteString(` AND type IN (?` + strings.Repeat(`, ?`, len(f.Types)-1) + `)`)
+		for _, t := range f.Types {
+			args = append(args, t)
+		}
+	}
+	if len(f.PathPrefixes) > 0 {
+		for _, column := range []string{"input_path", "output_path"} {
+			conds := make([]string, len(f.PathPrefixes))
+			for i, prefix := range f.PathPrefixes {
+				var condArgs []interface{}
+				conds[i], condArgs = pathUnderCond(column, filepath.Clean(prefix))
+				args = append(args, condArgs...)
+			}
+			sb.WriteString(` AND (` + strings.Join(conds, ` OR `) + `)`)
+		}
+	}
+	if f.ExcludeChunked {
+		sb.WriteString(` AND NOT ` + chunkedCondition)
+	}
+	if len(f.ExcludeTypes) > 0 {
+		sb.WriteString(` AND type NOT IN (?` + strings.Repeat(`, ?`, len(f.ExcludeTypes)-1) + `)`)
+		for _, t := range f.ExcludeTypes {
+			args = append(args, t)
+		}
+	}
+	if len(f.ExcludeOwners) > 0 {
+		sb.WriteString(` AND COALESCE(owner, '') NOT IN (?` + strings.Repeat(`, ?`, len(f.ExcludeOwners)-1) + `)`)
+		for _, o := range f.ExcludeOwners {
+			args = append(args, o)
+		}
+	}
+	if len(f.ExcludeIDs) > 0 {
+		sb.WriteString(` AND id NOT IN (?` + strings.Repeat(`, ?`, len(f.ExcludeIDs)-1) + `)`)
+		for _, id := range f.ExcludeIDs {
+			args = append(args, id)
+		}
+	}
+	for _, dir := range f.ExcludeDirs {
+		cond, condArgs := pathUnderCond("output_path", dir)
+		sb.WriteString(` AND NOT ` + cond)
+		args = append(args, condArgs...)
+	}
+	return sb.String(), args
+}
+
+// fairGroupExpr 公平调度的分组表达式，与 worker 中按任务字段计算的分组一致
+func fairGroupExpr(mode string) string {
+	if mode == models.FairByBatch {
+		return `CASE WHEN COALESCE(batch_id, '') = '' THEN 'task:' || id ELSE 'batch:' || batch_id END`
+	}
+	return `COALESCE(owner, '')`
+}
+
+// GetReadyTasks 按队列顺序返回现在可以执行的任务，最多 limit 个。
+// after 不为空时从该位置之后开始，filter 中排除的任务不返回
+func (db *DB) GetReadyTasks(now time.Time, filter ReadyFilter, after *QueueCursor, limit int) ([]*models.Task, error) {
+	cond, filterArgs := filter.where()
+	query := `SELECT ` + taskColumns + ` FROM tasks WHERE ` + readyCondition + cond
+	args := append([]interface{}{now, now}, filterArgs...)
+	if after != nil {
+		query += ` AND (priority < ? OR (priority = ? AND id > ?))`
+		args = append(args, after.Priority, after.Priority, after.ID)
+	}
+	query += ` ORDER BY priority DESC, id ASC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := scanTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, db.loadDependencies(tasks)
+}
+
+// GetReadyHeads 按 mode 对现在可以执行的任务分组，返回每组排在最前的任务
+func (db *DB) GetReadyHeads(now time.Time, mode string, filter ReadyFilter) ([]*models.Task, error) {
+	cond, filterArgs := filter.where()
+	query := `SELECT ` + taskColumns + ` FROM (
+		SELECT *, ROW_NUMBER() OVER (PARTITION BY ` + fairGroupExpr(mode) + ` ORDER BY priority DESC, id ASC) AS group_rank
+		FROM tasks WHERE ` + readyCondition + cond + `
+	) AS tasks WHERE group_rank = 1 ORDER BY priority DESC, id ASC`
+	args := append([]interface{}{now, now}, filterArgs...)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := scanTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, db.loadDependencies(tasks)
+}
+
+// ClaimTask 把可领取的任务原子地标记为 running。
+// 任务已被领取、暂停、取消或删除时返回 false
+func (db *DB) ClaimTask(id int64) (bool, error) {
+	result, err := db.conn.Exec(`
+		UPDATE tasks SET status = ?, waiting_reason = NULL, updated_at = ? WHERE id = ? AND `+claimableCondition,
+		models.TaskStatusRunning, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// NextReadyTime 返回可领取但尚未到 notBefore 或重试时间的任务中最早可以执行的时间，没有时返回零值
+func (db *DB) NextReadyTime(now time.Time) (time.Time, error) {
+	var jd sql.NullFloat64
+	err := db.conn.QueryRow(`
+		SELECT MIN(ready) FROM (
+			SELECT MAX(COALESCE(julianday(not_before), 0), COALESCE(julianday(next_attempt_at), 0)) AS ready
+			FROM tasks WHERE `+claimableCondition+`
+		) WHERE ready > julianday(?)
+	`, now).Scan(&jd)
+	if err != nil || !jd.Valid {
+		return time.Time{}, err
+	}
+	// julianday 2440587.5 为 Unix 纪元
+	ms := int64((jd.Float64 - 2440587.5) * 86400 * 1000)
+	return time.UnixMilli(ms), nil
+}
+
+// GetClaimableTypes 返回可领取的任务涉及的任务类型
+func (db *DB) GetClaimableTypes() ([]models.TaskType, error) {
+	rows, err := db.conn.Query(`SELECT DISTINCT type FROM tasks WHERE ` + claimableCondition)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var types []models.TaskType
+	for rows.Next() {
+		var t models.TaskType
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
+
+// GetQueueOrder 按队列顺序返回等待中的任务（含已暂停的）
+func (db *DB) GetQueueOrder() ([]QueueEntry, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, priority, status, type, COALESCE(owner, ''), COALESCE(batch_id, ''), weight
+		FROM tasks WHERE ` + queuedCondition + ` ORDER BY priority DESC, id ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []QueueEntry
+	for rows.Next() {
+		var e QueueEntry
+		if err := rows.Scan(&e.ID, &e.Priority, &e.Status, &e.Type, &e.Owner, &e.BatchID, &e.Weight); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// CountQueuedTasks 统计等待中的任务数（含已暂停的）
+func (db *DB) CountQueuedTasks() (int, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM tasks WHERE ` + queuedCondition).Scan(&count)
+	return count, err
+}
+
+// IsQueued 任务是否在等待队列中
+func (db *DB) IsQueued(id int64) (bool, error) {
+	var count int
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM tasks WHERE id = ? AND `+queuedCondition, id).Scan(&count)
+	return count > 0, err
+}
+
+// SetQueuedTaskStatus 把等待中、状态为 from 之一的任务改为 to，返回是否有修改
+func (db *DB) SetQueuedTaskStatus(id int64, from []models.TaskStatus, to models.TaskStatus) (bool, error) {
+	args := []interface{}{to, time.Now(), id}
+	for _, s := range from {
+		args = append(args, s)
+	}
+	result, err := db.conn.Exec(`
+		UPDATE tasks SET status = ?, waiting_reason = NULL, updated_at = ? WHERE id = ? AND `+queuedCondition+`
+		AND status IN (?`+strings.Repeat(`, ?`, len(from)-1)+`)`, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// RaiseQueuedPriority 把等待中任务的优先级提高到 priority，返回是否有修改
+func (db *DB) RaiseQueuedPriority(id int64, priority int) (bool, error) {
+	result, err := db.conn.Exec(`
+		UPDATE tasks SET priority = ?, updated_at = ? WHERE id = ? AND priority < ? AND `+queuedCondition,
+		priority, time.Now(), id, priority)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// GetRecoverableTasks 获取服务重启时需要处理的任务：上次仍在运行或被中断、留有进程号或远程租约、
+// 已取消但状态被覆盖，以及有进度的已暂停任务
+func (db *DB) GetRecoverableTasks() ([]*models.Task, error) {
+	rows, err := db.conn.Query(`
+		SELECT ` + taskColumns + ` FROM tasks
+		WHERE status IN ('pending', 'running', 'paused', 'interrupted', 'waiting_resources') AND (
+			status IN ('running', 'interrupted')
+			OR pid > 0
+			OR COALESCE(worker_id, '') != ''
+			OR canceled_at IS NOT NULL
+			OR (status = 'paused' AND progress > 0)
+			OR id IN (SELECT task_id FROM task_segments WHERE pid > 0)
+		)
+		ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := scanTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+	return tasks, db.loadDependencies(tasks)
+}
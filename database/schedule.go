@@ -0,0 +1,77 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"videoforge/models"
+)
+
+// CreateSchedule 创建定时批量任务
+func (db *DB) CreateSchedule(s *models.Schedule) error {
+	s.CreatedAt = time.Now()
+	result, err := db.conn.Exec(`
+		INSERT INTO schedules (name, cron, batch, enabled, next_run_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, s.Name, s.Cron, string(s.Batch), s.Enabled, s.NextRunAt, s.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	s.ID = id
+	return nil
+}
+
+// GetSchedules 获取所有定时批量任务
+func (db *DB) GetSchedules() ([]*models.Schedule, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, name, cron, batch, enabled, last_run_at, next_run_at, COALESCE(last_error,'') AS last_error, created_at
+		FROM schedules ORDER BY id ASC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []*models.Schedule
+	for rows.Next() {
+		s := &models.Schedule{}
+		var batch string
+		var lastRunAt, nextRunAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.Name, &s.Cron, &batch, &s.Enabled, &lastRunAt, &nextRunAt, &s.LastError, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		s.Batch = []byte(batch)
+		if lastRunAt.Valid {
+			s.LastRunAt = &lastRunAt.Time
+		}
+		if nextRunAt.Valid {
+			s.NextRunAt = &nextRunAt.Time
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// UpdateScheduleRun 记录定时任务的执行结果和下次执行时间
+func (db *DB) UpdateScheduleRun(id int64, lastRunAt time.Time, nextRunAt *time.Time, lastError string) error {
+	_, err := db.conn.Exec(`
+		UPDATE schedules SET last_run_at = ?, next_run_at = ?, last_error = ? WHERE id = ?
+	`, lastRunAt, nextRunAt, lastError, id)
+	return err
+}
+
+// UpdateScheduleNextRun 只更新下次执行时间
+func (db *DB) UpdateScheduleNextRun(id int64, nextRunAt *time.Time) error {
+	_, err := db.conn.Exec(`UPDATE schedules SET next_run_at = ? WHERE id = ?`, nextRunAt, id)
+	return err
+}
+
+// DeleteSchedule 删除定时批量任务
+func (db *DB) DeleteSchedule(id int64) error {
+	_, err := db.conn.Exec(`DELETE FROM schedules WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,63 @@
+package database
+
+import "videoforge/models"
+
+// GetTaskSegments 获取任务的分段列表，按序号排序。没有记录表示尚未切分
+func (db *DB) GetTaskSegments(taskID int64) ([]*models.TaskSegment, error) {
+	rows, err := db.conn.Query(`
+		SELECT task_id, idx, duration, done, pid FROM task_segments WHERE task_id = ? ORDER BY idx ASC
+	`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var segments []*models.TaskSegment
+	for rows.Next() {
+		s := &models.TaskSegment{}
+		if err := rows.Scan(&s.TaskID, &s.Index, &s.Duration, &s.Done, &s.PID); err != nil {
+			return nil, err
+		}
+		segments = append(segments, s)
+	}
+	return segments, rows.Err()
+}
+
+// CreateTaskSegments 记录切分得到的分段，替换该任务已有的分段记录
+func (db *DB) CreateTaskSegments(taskID int64, segments []*models.TaskSegment) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM task_segments WHERE task_id = ?`, taskID); err != nil {
+		return err
+	}
+	for _, s := range segments {
+		if _, err := tx.Exec(`
+			INSERT INTO task_segments (task_id, idx, duration, done) VALUES (?, ?, ?, ?)
+		`, taskID, s.Index, s.Duration, s.Done); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetTaskSegmentDone 标记分段是否已转码完成
+func (db *DB) SetTaskSegmentDone(taskID int64, index int, done bool) error {
+	_, err := db.conn.Exec(`UPDATE task_segments SET done = ? WHERE task_id = ? AND idx = ?`, done, taskID, index)
+	return err
+}
+
+// SetTaskSegmentPID 记录正在转码该分段的 FFmpeg 进程 PID，0 表示没有进程
+func (db *DB) SetTaskSegmentPID(taskID int64, index int, pid int) error {
+	_, err := db.conn.Exec(`UPDATE task_segments SET pid = ? WHERE task_id = ? AND idx = ?`, pid, taskID, index)
+	return err
+}
+
+// DeleteTaskSegments 删除任务的分段记录
+func (db *DB) DeleteTaskSegments(taskID int64) error {
+	_, err := db.conn.Exec(`DELETE FROM task_segments WHERE task_id = ?`, taskID)
+	return err
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+	"videoforge/models"
+)
+
+const trashColumns = `id, task_id, original_path, trash_path, size, status, trashed_at, expires_at, restored_at, purged_at`
+
+// CreateTrashItem 记录移入回收站的原文件
+func (db *DB) CreateTrashItem(item *models.TrashItem) error {
+	result, err := db.conn.Exec(`
+		INSERT INTO trash (task_id, original_path, trash_path, size, status, trashed_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, item.TaskID, item.OriginalPath, item.TrashPath, item.Size, item.Status, item.TrashedAt, item.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	item.ID = id
+	return nil
+}
+
+// GetTrashItem 获取单个回收站记录
+func (db *DB) GetTrashItem(id int64) (*models.TrashItem, error) {
+	row := db.conn.QueryRow(`SELECT `+trashColumns+` FROM trash WHERE id = ?`, id)
+	return scanTrashItem(row)
+}
+
+// GetTrashItems 获取回收站记录，taskID 为 0 或 status 为空时不按该条件过滤
+func (db *DB) GetTrashItems(taskID int64, status models.TrashStatus) ([]*models.TrashItem, error) {
+	rows, err := db.conn.Query(`
+		SELECT `+trashColumns+` FROM trash
+		WHERE (? = 0 OR task_id = ?) AND (? = '' OR status = ?)
+		ORDER BY id DESC
+	`, taskID, taskID, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.TrashItem
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetExpiredTrashItems 获取已超过保留期限、仍在回收站中的记录。
+// 时间可能带有不同的时区，用 julianday 比较
+func (db *DB) GetExpiredTrashItems(now time.Time) ([]*models.TrashItem, error) {
+	rows, err := db.conn.Query(`
+		SELECT `+trashColumns+` FROM trash
+		WHERE status = ? AND expires_at IS NOT NULL AND julianday(expires_at) <= julianday(?)
+		ORDER BY id ASC
+	`, models.TrashStatusTrashed, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*models.TrashItem
+	for rows.Next() {
+		item, err := scanTrashItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// MarkTrashRestored 记录原文件已从回收站恢复
+func (db *DB) MarkTrashRestored(id int64) error {
+	_, err := db.conn.Exec(`UPDATE trash SET status = ?, restored_at = ? WHERE id = ?`,
+		models.TrashStatusRestored, time.Now(), id)
+	return err
+}
+
+// MarkTrashPurged 记录回收站中的文件已被永久删除
+func (db *DB) MarkTrashPurged(id int64) error {
+	_, err := db.conn.Exec(`UPDATE trash SET status = ?, purged_at = ? WHERE id = ?`,
+		models.TrashStatusPurged, time.Now(), id)
+	return err
+}
+
+func scanTrashItem(row rowScanner) (*models.TrashItem, error) {
+	item := &models.TrashItem{}
+	var expiresAt, restoredAt, purgedAt sql.NullTime
+	if err := row.Scan(&item.ID, &item.TaskID, &item.OriginalPath, &item.TrashPath, &item.Size,
+		&item.Status, &item.TrashedAt, &expiresAt, &restoredAt, &purgedAt); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		item.ExpiresAt = &expiresAt.Time
+	}
+	if restoredAt.Valid {
+		item.RestoredAt = &restoredAt.Time
+	}
+	if purgedAt.Valid {
+		item.PurgedAt = &purgedAt.Time
+	}
+	return item, nil
+}
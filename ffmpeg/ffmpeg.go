@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,6 +18,7 @@ import (
 type FFmpeg struct {
 	BinaryPath string
 	Threads    int
+	Log        *TaskLog // 不为空时记录命令行和完整的 stderr
 }
 
 func NewFFmpeg(binaryPath string, threads int) *FFmpeg {
@@ -26,12 +28,24 @@ func NewFFmpeg(binaryPath string, threads int) *FFmpeg {
 	}
 }
 
+// WithLog 返回把命令行和 stderr 写入 log 的副本
+func (f *FFmpeg) WithLog(log *TaskLog) *FFmpeg {
+	c := *f
+	c.Log = log
+	return &c
+}
+
 // TaskParams 任务参数
 type TranscodeParams struct {
 	VideoCodec string `json:"videoCodec"` // h264, h265, vp9
 	AudioCodec string `json:"audioCodec"` // aac, mp3
 	Bitrate    string `json:"bitrate"`    // 2M, 5M
 	Resolution string `json:"resolution"` // 1920x1080, 1280x720
+
+	// 分段模式：按关键帧切分后逐段转码再合并，中断后从已完成的分段继续
+	Chunked         bool `json:"chunked,omitempty"`
+	SegmentDuration int  `json:"segmentDuration,omitempty"` // 分段时长（秒），默认 300；并行模式下默认按 parallel 均分
+	Parallel        int  `json:"parallel,omitempty"`        // 同时转码的分段数，大于 1 时启用分段模式
 }
 
 type TrimParams struct {
@@ -140,7 +154,32 @@ func (f *FFmpeg) Trim(inputPath, outputPath, paramsJSON string, callback Progres
 
 	args = append(args, "-c", "copy", "-y", outputPath)
 
-	return f.runWithProgress(inputPath, args, callback)
+	// 进度按裁剪后的时长计算
+	duration, err := f.GetVideoDuration(inputPath)
+	if err != nil {
+		duration = 0
+	}
+	return f.runWithDuration(params.OutputDuration(duration), args, callback)
+}
+
+// OutputDuration 根据输入时长计算裁剪后的时长，无法确定时返回 0
+func (p TrimParams) OutputDuration(inputDuration float64) float64 {
+	if inputDuration <= 0 {
+		return 0
+	}
+	start := 0.0
+	if p.StartTime != "" {
+		if v, err := ParseTimestamp(p.StartTime); err == nil {
+			start = v
+		}
+	}
+	remaining := math.Max(inputDuration-start, 0)
+	if p.Duration != "" {
+		if v, err := ParseTimestamp(p.Duration); err == nil && v < remaining {
+			return v
+		}
+	}
+	return remaining
 }
 
 // GenerateThumbnails 生成缩略图
@@ -183,11 +222,15 @@ func (f *FFmpeg) runWithProgress(inputPath string, args []string, callback Progr
 	if err != nil {
 		duration = 0
 	}
+	return f.runWithDuration(duration, args, callback)
+}
 
+// runWithDuration 同 runWithProgress，进度按给定的总时长计算
+func (f *FFmpeg) runWithDuration(duration float64, args []string, callback ProgressCallback) (*exec.Cmd, error) {
 	args = append([]string{
 		"-progress", "pipe:2",
 		"-nostats",
-		"-loglevel", "error",
+		"-loglevel", LogLevel,
 	}, args...)
 
 	// 添加线程数限制，防止 CPU 100%
@@ -196,6 +239,10 @@ func (f *FFmpeg) runWithProgress(inputPath string, args []string, callback Progr
 	}
 
 	cmd := exec.Command(f.BinaryPath, args...)
+	setProcAttr(cmd)
+	if f.Log != nil {
+		f.Log.Command(f.BinaryPath, args)
+	}
 
 	// 同时捕获 stdout 和 stderr，便于调试
 	stdout, err := cmd.StdoutPipe()
@@ -203,26 +250,38 @@ func (f *FFmpeg) runWithProgress(inputPath string, args []string, callback Progr
 		return nil, err
 	}
 
-	stderr, err := cmd.StderrPipe()
+	// stderr 使用独立的管道：Wait 不会在读完之前关闭它，最后的错误输出不会丢失
+	stderr, stderrW, err := os.Pipe()
 	if err != nil {
 		return nil, err
 	}
+	cmd.Stderr = stderrW
 
 	if err := cmd.Start(); err != nil {
+		stderr.Close()
+		stderrW.Close()
 		return nil, err
 	}
+	stderrW.Close()
+	if f.Log != nil {
+		f.Log.readers.Add(1)
+	}
 
 	// 独立 goroutine 实时读取 stderr，解析进度
 	go func(totalDuration float64) {
+		defer stderr.Close()
+		if f.Log != nil {
+			defer f.Log.readers.Done()
+		}
 		scanner := bufio.NewScanner(stderr)
 		// 匹配行中任意位置的 time=HH:MM:SS.xx
 		progressRe := regexp.MustCompile(`time=([0-9]{2}):([0-9]{2}):([0-9]{2}\.[0-9]{2})`)
 
 		for scanner.Scan() {
 			line := scanner.Text()
-
-			// 调试输出 FFmpeg 日志，便于确认 stderr 被正确捕获
-			// log.Printf("ffmpeg stderr: %s", line)
+			if f.Log != nil {
+				f.Log.Line(line)
+			}
 
 			if matches := progressRe.FindStringSubmatch(line); len(matches) >= 4 {
 				hours, _ := strconv.ParseFloat(matches[1], 64)
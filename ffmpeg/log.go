@@ -0,0 +1,217 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogLevel FFmpeg 的日志级别。level 前缀让每行带上 [error] 等标记，便于提取错误
+const LogLevel = "level+info"
+
+// errorTailLines ErrorSummary 最多返回的行数
+const errorTailLines = 5
+
+var (
+	// progressLineRe -progress 输出的 key=value 行，只用于解析进度，不写入日志
+	progressLineRe = regexp.MustCompile(`^[a-z_0-9]+=\S*$`)
+	// statsLineRe 编码统计行（frame=… time=…），写入日志但不作为错误原因
+	statsLineRe = regexp.MustCompile(`^\s*(frame|size)=`)
+	// levelTagRe level 前缀中表示错误的标记
+	levelTagRe = regexp.MustCompile(`\[(error|fatal|panic)\] `)
+	// infoTagRe 其他级别的标记，未带标记的 FFmpeg 输出按错误行处理
+	infoTagRe = regexp.MustCompile(`\[(warning|info|verbose|debug|trace)\] `)
+)
+
+// TaskLog 任务的 FFmpeg 日志：命令行和 stderr 写入按大小轮转的文件，
+// 同时保留最近的错误行，FFmpeg 失败时作为错误原因
+type TaskLog struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	maxSize  int64 // 超过该字节数时轮转，0 表示不轮转
+	backups  int   // 保留的旧日志个数，path.1 最新
+	errLines []string
+	tail     []string // 没有带错误标记的行时，使用最后几行非进度输出
+
+	readers sync.WaitGroup // 仍在读取 stderr 的进程
+}
+
+// readersTimeout ErrorSummary 等待 stderr 读取结束的最长时间
+const readersTimeout = 2 * time.Second
+
+// OpenTaskLog 以追加方式打开任务日志，maxSize 为单个文件的最大字节数，backups 为轮转保留的旧文件数
+func OpenTaskLog(path string, maxSize int64, backups int) (*TaskLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	l := &TaskLog{path: path, maxSize: maxSize, backups: backups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *TaskLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// rotate 把 path 依次改名为 path.1、path.2……，超出 backups 的最旧文件删除。调用方需持有 mu
+func (l *TaskLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+	if l.backups <= 0 {
+		os.Remove(l.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.backups))
+		for i := l.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		os.Rename(l.path, l.path+".1")
+	}
+	return l.open()
+}
+
+// writeLocked 写入一行，必要时先轮转。调用方需持有 mu
+func (l *TaskLog) writeLocked(line string) {
+	if l.file == nil {
+		return
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line))+1 > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return
+		}
+	}
+	n, _ := l.file.WriteString(line + "\n")
+	l.size += int64(n)
+}
+
+// Printf 写入一行说明，例如每次执行的开始时间
+func (l *TaskLog) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.writeLocked(fmt.Sprintf("[%s] ", time.Now().Format("2006-01-02 15:04:05")) + fmt.Sprintf(format, args...))
+}
+
+// Command 记录即将执行的完整命令行
+func (l *TaskLog) Command(binary string, args []string) {
+	quoted := make([]string, 0, len(args)+1)
+	for _, a := range append([]string{binary}, args...) {
+		if a == "" || strings.ContainsAny(a, " \t\"'") {
+			a = fmt.Sprintf("%q", a)
+		}
+		quoted = append(quoted, a)
+	}
+	l.Printf("$ %s", strings.Join(quoted, " "))
+}
+
+// Line 记录一行 FFmpeg 输出，进度行不写入
+func (l *TaskLog) Line(line string) {
+	if strings.TrimSpace(line) == "" || progressLineRe.MatchString(line) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.writeLocked(line)
+	if levelTagRe.MatchString(line) {
+		l.errLines = appendLimited(l.errLines, levelTagRe.ReplaceAllString(line, ""))
+	} else if !infoTagRe.MatchString(line) && !statsLineRe.MatchString(line) {
+		l.tail = appendLimited(l.tail, line)
+	}
+}
+
+// appendLimited 追加一行，只保留最后 errorTailLines 行
+func appendLimited(lines []string, line string) []string {
+	lines = append(lines, line)
+	if len(lines) > errorTailLines {
+		lines = lines[len(lines)-errorTailLines:]
+	}
+	return lines
+}
+
+// ErrorSummary 返回最后几行有意义的错误输出，没有时返回空。
+// 先等待 stderr 读取结束，避免进程刚退出时最后的错误行还没有读到
+func (l *TaskLog) ErrorSummary() string {
+	done := make(chan struct{})
+	go func() {
+		l.readers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(readersTimeout):
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lines := l.errLines
+	if len(lines) == 0 {
+		lines = l.tail
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Close 关闭日志文件
+func (l *TaskLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// LogFiles 返回 path 的日志文件，按从旧到新排列，不存在的文件不返回
+func LogFiles(path string, backups int) []string {
+	var files []string
+	for i := backups; i >= 1; i-- {
+		name := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(name); err == nil {
+			files = append(files, name)
+		}
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files
+}
+
+// ExitError FFmpeg 非零退出，Stderr 为从日志中提取的错误输出
+type ExitError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *ExitError) Error() string {
+	if e.Stderr == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Stderr
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
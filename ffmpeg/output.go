@@ -0,0 +1,181 @@
+package ffmpeg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 输出先写入同目录下的临时文件（或目录），FFmpeg 成功结束后再 fsync 并重命名为最终路径，
+// 失败或被终止的任务不会在最终路径留下不完整的文件，也不会覆盖之前成功的结果
+
+// PartialPath 返回 outputPath 对应的临时输出路径，例如 out/.name.partial.mp4，保留扩展名以便 FFmpeg 识别封装格式。
+// HLS 播放列表按文件名引用分片，播放列表和分片一起写入临时目录 out/.name.m3u8.partial/ 中的同名文件
+func PartialPath(outputPath string) string {
+	if isHLS(outputPath) {
+		return filepath.Join(hlsPartialDir(outputPath), filepath.Base(outputPath))
+	}
+
+	dir, name := filepath.Split(outputPath)
+	ext := filepath.Ext(name)
+	return filepath.Join(dir, "."+strings.TrimSuffix(name, ext)+".partial"+ext)
+}
+
+func isHLS(outputPath string) bool {
+	return strings.EqualFold(filepath.Ext(outputPath), ".m3u8")
+}
+
+// hlsPartialDir HLS 输出的临时目录
+func hlsPartialDir(outputPath string) string {
+	dir, name := filepath.Split(outputPath)
+	return filepath.Join(dir, "."+name+".partial")
+}
+
+// PreparePartial 创建临时输出所在的目录。HLS 的临时目录先清空，上次留下的分片不会一起提交
+func PreparePartial(outputPath string) error {
+	if isHLS(outputPath) {
+		if err := os.RemoveAll(hlsPartialDir(outputPath)); err != nil {
+			return err
+		}
+	}
+	return os.MkdirAll(filepath.Dir(PartialPath(outputPath)), 0755)
+}
+
+// CommitOutput 把临时输出 fsync 后重命名为 outputPath。
+// 目录（缩略图）整体替换：旧目录先移开，新目录就位后再删除旧目录；
+// HLS 先移动分片，最后移动播放列表，播放列表出现时引用的分片都已就位
+func CommitOutput(partialPath, outputPath string) error {
+	if partialPath == outputPath {
+		return nil
+	}
+	if isHLS(outputPath) {
+		return commitHLS(outputPath)
+	}
+
+	info, err := os.Stat(partialPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return commitDir(partialPath, outputPath)
+	}
+
+	if err := syncFile(partialPath); err != nil {
+		return err
+	}
+	if err := os.Rename(partialPath, outputPath); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(outputPath))
+	return nil
+}
+
+// DiscardOutput 删除失败或被取消的任务留下的临时输出
+func DiscardOutput(partialPath, outputPath string) error {
+	if partialPath == outputPath {
+		return nil
+	}
+	if isHLS(outputPath) {
+		return os.RemoveAll(hlsPartialDir(outputPath))
+	}
+	return os.RemoveAll(partialPath)
+}
+
+func commitHLS(outputPath string) error {
+	partialDir := hlsPartialDir(outputPath)
+	entries, err := os.ReadDir(partialDir)
+	if err != nil {
+		return err
+	}
+	playlist := filepath.Base(outputPath)
+	if _, err := os.Stat(filepath.Join(partialDir, playlist)); err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(outputPath)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || entry.Name() == playlist {
+			continue
+		}
+		src := filepath.Join(partialDir, entry.Name())
+		if err := syncFile(src); err != nil {
+			return err
+		}
+		if err := os.Rename(src, filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	src := filepath.Join(partialDir, playlist)
+	if err := syncFile(src); err != nil {
+		return err
+	}
+	if err := os.Rename(src, outputPath); err != nil {
+		return err
+	}
+	syncDir(dir)
+	return os.RemoveAll(partialDir)
+}
+
+func commitDir(partialPath, outputPath string) error {
+	entries, err := os.ReadDir(partialPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			if err := syncFile(filepath.Join(partialPath, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	syncDir(partialPath)
+
+	dir, name := filepath.Split(outputPath)
+	oldPath := filepath.Join(dir, "."+name+".old")
+	if err := os.RemoveAll(oldPath); err != nil {
+		return err
+	}
+
+	hadOld := false
+	if _, err := os.Stat(outputPath); err == nil {
+		if err := os.Rename(outputPath, oldPath); err != nil {
+			return err
+		}
+		hadOld = true
+	}
+
+	if err := os.Rename(partialPath, outputPath); err != nil {
+		// 恢复旧目录
+		if hadOld {
+			os.Rename(oldPath, outputPath)
+		}
+		return err
+	}
+	syncDir(filepath.Dir(outputPath))
+
+	if hadOld {
+		return os.RemoveAll(oldPath)
+	}
+	return nil
+}
+
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir 持久化目录项的变化，部分系统（如 Windows）不支持，忽略错误
+func syncDir(path string) {
+	if f, err := os.Open(path); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
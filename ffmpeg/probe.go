@@ -0,0 +1,70 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProbeInfo 媒体文件的时长和各类型流的数量
+type ProbeInfo struct {
+	Duration float64 // 秒，无法获取时为 0
+	Video    int
+	Audio    int
+	Subtitle int
+}
+
+var (
+	probeDurationRe = regexp.MustCompile(`Duration: (\d{2}):(\d{2}):(\d{2}\.\d{2})`)
+	probeStreamRe   = regexp.MustCompile(`Stream #\d+:\d+.*?: (Video|Audio|Subtitle):`)
+)
+
+// Probe 读取媒体文件信息，文件无法打开或没有任何音视频流时返回错误
+func (f *FFmpeg) Probe(path string) (*ProbeInfo, error) {
+	cmd := exec.Command(f.BinaryPath, "-hide_banner", "-i", path)
+	output, _ := cmd.CombinedOutput()
+
+	info := &ProbeInfo{}
+	if matches := probeDurationRe.FindStringSubmatch(string(output)); len(matches) >= 4 {
+		hours, _ := strconv.ParseFloat(matches[1], 64)
+		minutes, _ := strconv.ParseFloat(matches[2], 64)
+		seconds, _ := strconv.ParseFloat(matches[3], 64)
+		info.Duration = hours*3600 + minutes*60 + seconds
+	}
+
+	for _, matches := range probeStreamRe.FindAllStringSubmatch(string(output), -1) {
+		switch matches[1] {
+		case "Video":
+			info.Video++
+		case "Audio":
+			info.Audio++
+		case "Subtitle":
+			info.Subtitle++
+		}
+	}
+
+	if info.Video == 0 && info.Audio == 0 {
+		return nil, fmt.Errorf("no audio or video streams found in %s", path)
+	}
+	return info, nil
+}
+
+// ParseTimestamp 解析 HH:MM:SS[.ms]、MM:SS 或秒数格式的时间
+func ParseTimestamp(s string) (float64, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+
+	var seconds float64
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		seconds = seconds*60 + v
+	}
+	return seconds, nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package ffmpeg
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcAttr 让 FFmpeg 运行在独立的进程组中，便于整组终止，且不会收到终端的 Ctrl+C
+func setProcAttr(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
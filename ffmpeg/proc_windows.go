@@ -0,0 +1,8 @@
+//go:build windows
+
+package ffmpeg
+
+import "os/exec"
+
+// setProcAttr Windows 下不需要设置进程组
+func setProcAttr(cmd *exec.Cmd) {}
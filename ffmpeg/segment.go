@@ -0,0 +1,115 @@
+package ffmpeg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 分段转码：先按关键帧把输入切成若干分段（流复制，不重新编码），
+// 逐段转码后再用 concat demuxer 无损合并，中断后可以从已完成的分段继续
+
+// DefaultSegmentDuration 默认分段时长（秒）
+const DefaultSegmentDuration = 300
+
+// ParseTranscodeParams 解析转码参数
+func ParseTranscodeParams(paramsJSON string) (TranscodeParams, error) {
+	var params TranscodeParams
+	if paramsJSON == "" {
+		return params, nil
+	}
+	err := json.Unmarshal([]byte(paramsJSON), &params)
+	return params, err
+}
+
+// IsChunked 是否使用分段模式
+func (p TranscodeParams) IsChunked() bool {
+	return p.Chunked || p.Parallel > 1
+}
+
+// SegmentSeconds 分段时长。未设置时，并行模式把总时长均分为 parallel 段，否则使用默认值
+func (p TranscodeParams) SegmentSeconds(totalDuration float64) int {
+	if p.SegmentDuration > 0 {
+		return p.SegmentDuration
+	}
+	if p.Parallel > 1 && totalDuration > 0 {
+		return int(math.Ceil(totalDuration / float64(p.Parallel)))
+	}
+	return DefaultSegmentDuration
+}
+
+// SourceSegmentPath 切分得到的原始分段路径
+func SourceSegmentPath(workDir string, index int) string {
+	return filepath.Join(workDir, fmt.Sprintf("src_%05d.mkv", index))
+}
+
+// EncodedSegmentPath 转码后的分段路径
+func EncodedSegmentPath(workDir string, index int) string {
+	return filepath.Join(workDir, fmt.Sprintf("enc_%05d.mkv", index))
+}
+
+// SplitSegments 按关键帧把输入切成约 segmentSeconds 秒的分段，输出到 workDir
+func (f *FFmpeg) SplitSegments(inputPath, workDir string, segmentSeconds int, callback ProgressCallback) (*exec.Cmd, error) {
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-i", inputPath,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-c", "copy",
+		"-f", "segment",
+		"-segment_time", strconv.Itoa(segmentSeconds),
+		"-reset_timestamps", "1",
+		"-y",
+		filepath.Join(workDir, "src_%05d.mkv"),
+	}
+
+	return f.runWithProgress(inputPath, args, callback)
+}
+
+// ListSourceSegments 列出 workDir 中切分得到的原始分段，按序号排序
+func ListSourceSegments(workDir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(workDir, "src_*.mkv"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// ConcatSegments 用 concat demuxer 把已转码的分段合并为 outputPath。
+// inputPath 为原始输入，用于计算合并进度
+func (f *FFmpeg) ConcatSegments(inputPath string, segments []string, workDir, outputPath string, callback ProgressCallback) (*exec.Cmd, error) {
+	var list strings.Builder
+	for _, segment := range segments {
+		abs, err := filepath.Abs(segment)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(abs, "'", `'\''`))
+	}
+
+	listPath := filepath.Join(workDir, "concat.txt")
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+		"-map", "0",
+		"-c", "copy",
+		"-y",
+		outputPath,
+	}
+
+	return f.runWithProgress(inputPath, args, callback)
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 	"videoforge/api"
 	"videoforge/config"
 	"videoforge/database"
 	"videoforge/models"
+	"videoforge/schedule"
 	"videoforge/websocket"
 	"videoforge/worker"
 )
@@ -19,6 +25,17 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// videoforge worker：作为远程 worker 运行，从中心服务器领取任务
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		runAgent()
+		return
+	}
+
+	if err := worker.ValidateHooks(config.GlobalConfig.Hooks.Global, false); err != nil {
+		log.Fatalf("Invalid global hooks: %v", err)
+	}
+	worker.ValidateFairness()
+
 	// 初始化数据库
 	db, err := database.NewDB(config.GlobalConfig.Database.Path)
 	if err != nil {
@@ -39,6 +56,9 @@ func main() {
 	// 创建 API 服务器
 	apiServer := api.NewServer(db, queue)
 
+	// 启动定时批量任务
+	schedule.NewRunner(db, apiServer.RunBatch).Start()
+
 	// 设置路由
 	mux := http.NewServeMux()
 
@@ -49,29 +69,109 @@ func main() {
 		case http.MethodGet:
 			apiServer.GetTasks(w, r)
 		case http.MethodPost:
-			apiServer.CreateTask(w, r)
+			apiServer.Idempotent(apiServer.CreateTask)(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
 	mux.HandleFunc("/api/tasks/batch", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPost {
-			apiServer.BatchCreateTasks(w, r)
+			apiServer.Idempotent(apiServer.BatchCreateTasks)(w, r)
 		} else {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/api/tasks/conflicts", apiServer.GetOutputConflicts)
+	mux.HandleFunc("/api/pipelines", postOnly(apiServer.Idempotent(apiServer.CreatePipeline)))
 	mux.HandleFunc("/api/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/move"):
+			postOnly(apiServer.MoveTask)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/pause"):
+			postOnly(apiServer.PauseTask)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/resume"):
+			postOnly(apiServer.ResumeTask)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/cancel"):
+			postOnly(apiServer.CancelTask)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/hooks"):
+			apiServer.GetTaskHooks(w, r)
+		case strings.HasSuffix(r.URL.Path, "/log"):
+			apiServer.GetTaskLog(w, r)
+		case strings.HasSuffix(r.URL.Path, "/events"):
+			apiServer.GetTaskEvents(w, r)
+		case strings.HasSuffix(r.URL.Path, "/position"):
+			apiServer.GetTaskPosition(w, r)
+		default:
+			switch r.Method {
+			case http.MethodGet:
+				apiServer.GetTask(w, r)
+			case http.MethodDelete:
+				apiServer.DeleteTask(w, r)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		}
+	})
+	mux.HandleFunc("/api/task-types", apiServer.GetTaskTypes)
+	mux.HandleFunc("/api/queue", apiServer.GetQueueState)
+	mux.HandleFunc("/api/queue/positions", apiServer.GetQueuePositions)
+	mux.HandleFunc("/api/queue/pause", postOnly(apiServer.PauseQueue))
+	mux.HandleFunc("/api/queue/resume", postOnly(apiServer.ResumeQueue))
+	mux.HandleFunc("/api/queue/windows", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			apiServer.GetTimeWindows(w, r)
+		case http.MethodPut:
+			apiServer.SetTimeWindows(w, r)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/schedules", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			apiServer.GetTask(w, r)
-		case http.MethodDelete:
-			apiServer.DeleteTask(w, r)
+			apiServer.GetSchedules(w, r)
+		case http.MethodPost:
+			apiServer.CreateSchedule(w, r)
 		default:
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/api/schedules/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			apiServer.DeleteSchedule(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
 	mux.HandleFunc("/api/files/", apiServer.ServeFile)
+	mux.HandleFunc("/api/trash", apiServer.GetTrash)
+	mux.HandleFunc("/api/trash/purge", postOnly(apiServer.PurgeExpiredTrash))
+	mux.HandleFunc("/api/trash/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/restore"):
+			postOnly(apiServer.RestoreTrash)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/purge"):
+			postOnly(apiServer.PurgeTrash)(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	// 远程 worker 路由
+	mux.HandleFunc("/api/agent/claim", postOnly(apiServer.ClaimTask))
+	mux.HandleFunc("/api/agent/tasks/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/heartbeat"):
+			postOnly(apiServer.HeartbeatTask)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/complete"):
+			postOnly(apiServer.CompleteTask)(w, r)
+		case strings.HasSuffix(r.URL.Path, "/release"):
+			postOnly(apiServer.ReleaseTask)(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
 
 	// WebSocket 路由
 	mux.HandleFunc("/ws", hub.HandleWebSocket)
@@ -91,7 +191,54 @@ func main() {
 	os.MkdirAll(config.GlobalConfig.FFmpeg.DefaultOutputDir, 0755)
 	os.MkdirAll(config.GlobalConfig.VideoRootDir, 0755)
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// 收到 SIGINT/SIGTERM 后停止接收请求，等待运行中的任务结束，超时则中断
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigCh
+	log.Printf("Received %v, shutting down", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(ctx)
+
+	grace := time.Duration(config.GlobalConfig.Worker.ShutdownGracePeriod) * time.Second
+	queue.Shutdown(grace)
+	log.Printf("VideoForge stopped")
+}
+
+// runAgent 以远程 worker 模式运行，收到 SIGINT/SIGTERM 后等待运行中的任务结束
+func runAgent() {
+	cfg := config.GlobalConfig.Agent
+	if cfg.Server == "" {
+		log.Fatalf("agent.server is not configured")
+	}
+
+	agent := worker.NewAgent(cfg, config.GlobalConfig.FFmpeg.Path, config.GlobalConfig.FFmpeg.Threads)
+	agent.Run()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigCh
+	log.Printf("Received %v, shutting down", sig)
+
+	agent.Shutdown(time.Duration(config.GlobalConfig.Worker.ShutdownGracePeriod) * time.Second)
+	log.Printf("Worker stopped")
+}
+
+// postOnly 只允许 POST 请求
+func postOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
 	}
 }
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// 远程 worker 与中心服务器之间的 /api/agent 协议
+
+// ClaimRequest 远程 worker 领取任务的请求
+type ClaimRequest struct {
+	WorkerID     string   `json:"workerId"`
+	Host         string   `json:"host,omitempty"`         // worker 的主机名，记录在任务的 started 事件中
+	Types        []string `json:"types,omitempty"`        // 只领取这些类型的任务，为空表示全部
+	PathPrefixes []string `json:"pathPrefixes,omitempty"` // worker 能访问的服务器路径前缀，为空表示不限制
+}
+
+// ClaimResponse 领取到的任务及租约
+type ClaimResponse struct {
+	Task           *Task     `json:"task"`
+	LeaseExpiresAt time.Time `json:"leaseExpiresAt"`
+	LeaseDuration  int       `json:"leaseDuration"` // 租约时长（秒），worker 需在到期前发送心跳
+}
+
+// Heartbeat 远程 worker 的心跳，同时上报进度
+type Heartbeat struct {
+	WorkerID string  `json:"workerId"`
+	Progress float64 `json:"progress"`
+	Message  string  `json:"message"`
+}
+
+// TaskResult 远程 worker 上报的执行结果，Error 为空表示成功
+type TaskResult struct {
+	WorkerID     string        `json:"workerId"`
+	Error        string        `json:"error,omitempty"`
+	ErrorClass   string        `json:"errorClass,omitempty"`   // 错误类别，用于匹配重试策略
+	Verification *VerifyResult `json:"verification,omitempty"` // worker 对输出的校验结果
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// 任务生命周期事件
+const (
+	TaskEventQueued           = "queued"            // 加入等待队列
+	TaskEventStarted          = "started"           // 开始执行：本机记录 FFmpeg 的 PID 和主机名，远程记录 worker
+	TaskEventPaused           = "paused"            // 被暂停
+	TaskEventResumed          = "resumed"           // 从暂停中恢复
+	TaskEventWaitingResources = "waiting_resources" // 资源不足，暂缓启动
+	TaskEventRetried          = "retried"           // 执行失败，已安排重试
+	TaskEventRequeued         = "requeued"          // 执行被中断（服务重启、租约过期或 worker 放弃），重新排队
+	TaskEventInterrupted      = "interrupted"       // 服务停止时被终止
+	TaskEventFailed           = "failed"            // 最终失败，不再重试
+	TaskEventFinished         = "finished"          // 成功完成
+	TaskEventCanceled         = "canceled"          // 被取消
+	TaskEventSkipped          = "skipped"           // 输出已存在，按 onConflict 策略跳过
+)
+
+// TaskEvent 任务的一次状态变化，只追加不修改
+type TaskEvent struct {
+	ID        int64     `json:"id"`
+	TaskID    int64     `json:"taskId"`
+	Event     string    `json:"event"`
+	Attempt   int       `json:"attempt"`            // 事件发生时任务的执行次数
+	PID       int       `json:"pid,omitempty"`      // 本机 FFmpeg 进程号
+	Host      string    `json:"host,omitempty"`     // 执行任务的主机
+	WorkerID  string    `json:"workerId,omitempty"` // 远程 worker
+	Message   string    `json:"message,omitempty"`  // 原因或其他说明
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// 触发钩子的任务事件
+const (
+	HookEventFinished = "finished" // 任务成功完成
+	HookEventFailed   = "failed"   // 任务最终失败（不再重试）
+)
+
+// Hook 任务完成或失败后执行的钩子，Command 和 URL 二选一
+type Hook struct {
+	Name    string            `json:"name,omitempty"`
+	On      []string          `json:"on,omitempty"`      // 触发的事件：finished、failed，为空表示两者都触发
+	Command string            `json:"command,omitempty"` // 本地可执行文件，任务字段通过环境变量和 stdin 上的 JSON 传入
+	Args    []string          `json:"args,omitempty"`
+	URL     string            `json:"url,omitempty"`    // HTTP 调用，请求体为 JSON
+	Method  string            `json:"method,omitempty"` // 默认 POST
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout int               `json:"timeout,omitempty"` // 秒，为空时使用 hooks.timeout 配置
+}
+
+// HookRun 一次钩子执行的结果
+type HookRun struct {
+	ID         int64     `json:"id"`
+	TaskID     int64     `json:"taskId"`
+	Event      string    `json:"event"`
+	Name       string    `json:"name"`
+	Scope      string    `json:"scope"`           // task：随任务或批量任务提交，global：配置文件中的全局钩子
+	Target     string    `json:"target"`          // 命令或 URL
+	ExitCode   int       `json:"exitCode"`        // 命令的退出码，HTTP 调用为响应状态码，未能执行时为 -1
+	Output     string    `json:"output"`          // 命令的 stdout 和 stderr，或 HTTP 响应体，超过 64KB 时截断
+	Error      string    `json:"error,omitempty"` // 执行失败的原因，成功时为空
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+}
@@ -1,16 +1,36 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
 type TaskStatus string
 
 const (
-	TaskStatusPending  TaskStatus = "pending"
-	TaskStatusRunning  TaskStatus = "running"
-	TaskStatusFinished TaskStatus = "finished"
-	TaskStatusError    TaskStatus = "error"
+	TaskStatusPending     TaskStatus = "pending"
+	TaskStatusRunning     TaskStatus = "running"
+	TaskStatusFinished    TaskStatus = "finished"
+	TaskStatusError       TaskStatus = "error"
+	TaskStatusPaused      TaskStatus = "paused"
+	TaskStatusCanceled    TaskStatus = "canceled"
+	TaskStatusInterrupted TaskStatus = "interrupted"       // 服务停止时被中断，重启后重新执行
+	TaskStatusWaitingRes  TaskStatus = "waiting_resources" // 系统负载、内存或磁盘空间不足，暂缓启动
+	TaskStatusSkipped     TaskStatus = "skipped"           // 输出路径已存在且冲突策略为 skip，未执行
+)
+
+// 公平调度时同优先级任务的分组方式
+const (
+	FairByOwner = "owner" // 按提交者轮转
+	FairByBatch = "batch" // 按批次轮转，单独提交的任务各自为一组
+)
+
+// 输出路径已存在或与其他未完成任务相同时的处理方式
+const (
+	OnConflictOverwrite = "overwrite" // 覆盖
+	OnConflictSkip      = "skip"      // 不执行，保留已有文件
+	OnConflictRename    = "rename"    // 自动在文件名后加 _1、_2 等后缀
+	OnConflictFail      = "fail"      // 任务失败
 )
 
 type TaskType string
@@ -23,23 +43,88 @@ const (
 )
 
 type Task struct {
-	ID             int64      `json:"id"`
-	InputPath      string     `json:"inputPath"`
-	OutputPath     string     `json:"outputPath"`
-	Type           TaskType   `json:"type"`
-	Params         string     `json:"params"` // JSON string
-	Status         TaskStatus `json:"status"`
-	Progress       float64    `json:"progress"`
-	ErrorLog       string     `json:"errorLog"`
-	DeleteOriginal bool       `json:"deleteOriginal"`
-	CreatedAt      time.Time  `json:"createdAt"`
-	UpdatedAt      time.Time  `json:"updatedAt"`
+	ID             int64         `json:"id"`
+	InputPath      string        `json:"inputPath"`
+	OutputPath     string        `json:"outputPath"`
+	Type           TaskType      `json:"type"`
+	Params         string        `json:"params"` // JSON string
+	Status         TaskStatus    `json:"status"`
+	Progress       float64       `json:"progress"`
+	ErrorLog       string        `json:"errorLog"`
+	ErrorCode      string        `json:"errorCode,omitempty"`     // 最近一次失败的错误码，例如 invalid_data、unknown_encoder，重新执行或成功后清空
+	WaitingReason  string        `json:"waitingReason,omitempty"` // 处于 waiting_resources 时暂缓启动的原因
+	DeleteOriginal bool          `json:"deleteOriginal"`
+	Priority       int           `json:"priority"`                 // 数值越大越先执行
+	Attempts       int           `json:"attempts"`                 // 已执行次数
+	NextAttemptAt  *time.Time    `json:"nextAttemptAt,omitempty"`  // 下次重试时间，为空表示立即可执行
+	RetryPolicy    *RetryPolicy  `json:"retryPolicy,omitempty"`    // 任务级重试策略，为空时使用按类型配置的策略
+	DependsOn      []int64       `json:"dependsOn,omitempty"`      // 依赖的上游任务，全部完成后才会执行
+	NotBefore      *time.Time    `json:"notBefore,omitempty"`      // 最早开始时间，为空表示立即可执行
+	PID            int           `json:"pid,omitempty"`            // 正在运行的 FFmpeg 进程号
+	WorkerID       string        `json:"workerId,omitempty"`       // 领取该任务的远程 worker
+	LeaseExpiresAt *time.Time    `json:"leaseExpiresAt,omitempty"` // 远程 worker 的租约到期时间，到期未续约则任务回到 pending
+	Verification   *VerifyResult `json:"verification,omitempty"`   // 最近一次输出校验结果
+	CanceledAt     *time.Time    `json:"canceledAt,omitempty"`     // 取消时间，已取消的任务重启后不会重新执行
+	ContentKey     string        `json:"contentKey,omitempty"`     // 由输入文件、大小、修改时间、任务类型和参数计算，用于识别重复提交
+	OnConflict     string        `json:"onConflict,omitempty"`     // 输出路径冲突时的处理方式，为空时使用 ffmpeg.onConflict 配置
+	Hooks          []Hook        `json:"hooks,omitempty"`          // 任务完成或失败后执行的钩子，全局钩子在其后执行
+	Owner          string        `json:"owner,omitempty"`          // 提交者，公平调度和按提交者限制并发时使用
+	BatchID        string        `json:"batchId,omitempty"`        // 同一次批量提交或流水线创建的任务共享的批次 ID
+	Weight         int           `json:"weight,omitempty"`         // 公平调度的权重，为 0 时使用 worker.fairness.weights 中提交者的权重
+	CreatedAt      time.Time     `json:"createdAt"`
+	UpdatedAt      time.Time     `json:"updatedAt"`
 }
 
-type ProgressUpdate struct {
+// RetryPolicy 失败重试策略
+type RetryPolicy struct {
+	MaxAttempts  int      `json:"maxAttempts"`  // 最多执行次数（含首次），<=1 表示不重试
+	InitialDelay int      `json:"initialDelay"` // 第一次重试前等待的秒数
+	MaxDelay     int      `json:"maxDelay"`     // 退避等待的上限（秒）
+	Multiplier   float64  `json:"multiplier"`   // 每次重试等待时间的倍数，默认 2
+	RetryOn      []string `json:"retryOn"`      // 可重试的错误类别
+}
+
+// Schedule 按 cron 表达式定时执行的批量任务
+type Schedule struct {
+	ID        int64           `json:"id"`
+	Name      string          `json:"name"`
+	Cron      string          `json:"cron"`
+	Batch     json.RawMessage `json:"batch"` // 与 POST /api/tasks/batch 请求体相同的批量任务定义
+	Enabled   bool            `json:"enabled"`
+	LastRunAt *time.Time      `json:"lastRunAt,omitempty"`
+	NextRunAt *time.Time      `json:"nextRunAt,omitempty"`
+	LastError string          `json:"lastError"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// VerifyResult 任务完成后对输出的校验结果
+type VerifyResult struct {
+	Passed           bool      `json:"passed"`
+	Message          string    `json:"message,omitempty"` // 未通过的原因
+	OutputSize       int64     `json:"outputSize"`        // 字节，缩略图为所有图片的总大小
+	ExpectedDuration float64   `json:"expectedDuration,omitempty"`
+	OutputDuration   float64   `json:"outputDuration,omitempty"`
+	InputVideo       int       `json:"inputVideo"` // 输入视频流数量
+	InputAudio       int       `json:"inputAudio"`
+	OutputVideo      int       `json:"outputVideo"`
+	OutputAudio      int       `json:"outputAudio"`
+	CheckedAt        time.Time `json:"checkedAt"`
+}
+
+// TaskSegment 分段转码中的一个分段，用于中断后从已完成的分段继续
+type TaskSegment struct {
 	TaskID   int64   `json:"taskId"`
-	Progress float64 `json:"progress"`
-	Status   string  `json:"status"`
-	FileName string  `json:"fileName"`
-	Message  string  `json:"message"`
+	Index    int     `json:"index"`
+	Duration float64 `json:"duration"` // 秒，用于按时长加权计算整体进度
+	Done     bool    `json:"done"`
+	PID      int     `json:"pid,omitempty"` // 正在转码该分段的 FFmpeg 进程
+}
+
+type ProgressUpdate struct {
+	TaskID    int64   `json:"taskId"`
+	Progress  float64 `json:"progress"`
+	Status    string  `json:"status"`
+	FileName  string  `json:"fileName"`
+	Message   string  `json:"message"`
+	ErrorCode string  `json:"errorCode,omitempty"` // 任务失败或安排重试时的错误码
 }
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type TrashStatus string
+
+const (
+	TrashStatusTrashed  TrashStatus = "trashed"
+	TrashStatusRestored TrashStatus = "restored"
+	TrashStatusPurged   TrashStatus = "purged"
+)
+
+// TrashItem 任务完成后被移入回收站的原文件
+type TrashItem struct {
+	ID           int64       `json:"id"`
+	TaskID       int64       `json:"taskId"`       // 移入回收站的任务
+	OriginalPath string      `json:"originalPath"` // 原文件路径，恢复时移回此处
+	TrashPath    string      `json:"trashPath"`    // 回收站中的路径
+	Size         int64       `json:"size"`
+	Status       TrashStatus `json:"status"`
+	TrashedAt    time.Time   `json:"trashedAt"`
+	ExpiresAt    *time.Time  `json:"expiresAt,omitempty"` // 到期后由清理任务永久删除，为空表示一直保留
+	RestoredAt   *time.Time  `json:"restoredAt,omitempty"`
+	PurgedAt     *time.Time  `json:"purgedAt,omitempty"`
+}
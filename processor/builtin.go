@@ -0,0 +1,190 @@
+package processor
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"videoforge/ffmpeg"
+	"videoforge/models"
+)
+
+func init() {
+	Register(transcodeProcessor{})
+	Register(remuxProcessor{})
+	Register(trimProcessor{})
+	Register(thumbnailProcessor{})
+}
+
+// baseName 返回不含扩展名的文件名
+func baseName(inputPath string) string {
+	name := filepath.Base(inputPath)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// transcodeProcessor 转码
+type transcodeProcessor struct{}
+
+func (transcodeProcessor) Type() models.TaskType { return models.TaskTypeTranscode }
+
+func (transcodeProcessor) Description() string { return "转码" }
+
+func (transcodeProcessor) Params() []ParamField {
+	return []ParamField{
+		{Name: "videoCodec", Label: "视频编码", Type: ParamString, Default: "libx264", Options: []ParamOption{
+			{Value: "libx264", Label: "H.264"},
+			{Value: "libx265", Label: "H.265"},
+			{Value: "libvpx-vp9", Label: "VP9"},
+		}},
+		{Name: "audioCodec", Label: "音频编码", Type: ParamString, Default: "aac", Options: []ParamOption{
+			{Value: "aac", Label: "AAC"},
+			{Value: "libmp3lame", Label: "MP3"},
+		}},
+		{Name: "bitrate", Label: "比特率", Type: ParamString, Default: "2M", Placeholder: "例如: 2M"},
+		{Name: "resolution", Label: "分辨率", Type: ParamString, Placeholder: "例如: 1920x1080"},
+		{Name: "chunked", Label: "分段转码（中断后可继续）", Type: ParamBool},
+		{Name: "segmentDuration", Label: "分段时长 (秒)", Type: ParamInt, Default: ffmpeg.DefaultSegmentDuration, Min: intPtr(10)},
+		{Name: "parallel", Label: "并行分段数", Type: ParamInt, Default: 1, Min: intPtr(1)},
+	}
+}
+
+func (p transcodeProcessor) Validate(paramsJSON string) error {
+	_, err := validateFields(p.Params(), paramsJSON)
+	return err
+}
+
+func (transcodeProcessor) OutputPath(inputPath, outputDir, paramsJSON string) string {
+	return filepath.Join(outputDir, baseName(inputPath)+".mp4")
+}
+
+func (transcodeProcessor) OutputIsDir() bool { return false }
+
+func (transcodeProcessor) Command(ff *ffmpeg.FFmpeg, inputPath, outputPath, paramsJSON string, callback ffmpeg.ProgressCallback) (*exec.Cmd, error) {
+	return ff.Transcode(inputPath, outputPath, paramsJSON, callback)
+}
+
+func (transcodeProcessor) ExpectedDuration(paramsJSON string, inputDuration float64) float64 {
+	return inputDuration
+}
+
+// remuxProcessor 转封装，目标格式由 outputExtension 决定
+type remuxProcessor struct{}
+
+func (remuxProcessor) Type() models.TaskType { return models.TaskTypeRemux }
+
+func (remuxProcessor) Description() string { return "转封装" }
+
+func (remuxProcessor) Params() []ParamField {
+	return []ParamField{
+		{Name: "outputExtension", Label: "目标封装格式", Type: ParamString, Default: "mp4", Options: []ParamOption{
+			{Value: "mp4", Label: "MP4"},
+			{Value: "flv", Label: "FLV"},
+			{Value: "m3u8", Label: "M3U8(HLS)"},
+		}},
+	}
+}
+
+func (p remuxProcessor) Validate(paramsJSON string) error {
+	_, err := validateFields(p.Params(), paramsJSON)
+	return err
+}
+
+func (remuxProcessor) OutputPath(inputPath, outputDir, paramsJSON string) string {
+	ext := ".mp4"
+	var params ffmpeg.RemuxParams
+	if json.Unmarshal([]byte(paramsJSON), &params) == nil && params.OutputExtension != "" {
+		ext = params.OutputExtension
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+	}
+	return filepath.Join(outputDir, baseName(inputPath)+ext)
+}
+
+func (remuxProcessor) OutputIsDir() bool { return false }
+
+func (remuxProcessor) Command(ff *ffmpeg.FFmpeg, inputPath, outputPath, paramsJSON string, callback ffmpeg.ProgressCallback) (*exec.Cmd, error) {
+	return ff.Remux(inputPath, outputPath, paramsJSON, callback)
+}
+
+func (remuxProcessor) ExpectedDuration(paramsJSON string, inputDuration float64) float64 {
+	return inputDuration
+}
+
+// trimProcessor 裁剪，输出时长和进度按裁剪区间计算
+type trimProcessor struct{}
+
+func (trimProcessor) Type() models.TaskType { return models.TaskTypeTrim }
+
+func (trimProcessor) Description() string { return "裁剪" }
+
+func (trimProcessor) Params() []ParamField {
+	return []ParamField{
+		{Name: "startTime", Label: "起始时间 (HH:MM:SS)", Type: ParamDuration, Default: "00:00:00", Placeholder: "00:00:00"},
+		{Name: "duration", Label: "持续时间 (HH:MM:SS)", Type: ParamDuration, Default: "00:05:00", Placeholder: "00:05:00"},
+	}
+}
+
+func (p trimProcessor) Validate(paramsJSON string) error {
+	params, err := validateFields(p.Params(), paramsJSON)
+	if err != nil {
+		return err
+	}
+	if s, ok := params["duration"].(string); ok && s != "" {
+		if v, _ := ffmpeg.ParseTimestamp(s); v <= 0 {
+			return &ParamError{Field: "duration", Message: "must be greater than zero"}
+		}
+	}
+	return nil
+}
+
+func (trimProcessor) OutputPath(inputPath, outputDir, paramsJSON string) string {
+	return filepath.Join(outputDir, filepath.Base(inputPath))
+}
+
+func (trimProcessor) OutputIsDir() bool { return false }
+
+func (trimProcessor) Command(ff *ffmpeg.FFmpeg, inputPath, outputPath, paramsJSON string, callback ffmpeg.ProgressCallback) (*exec.Cmd, error) {
+	return ff.Trim(inputPath, outputPath, paramsJSON, callback)
+}
+
+func (trimProcessor) ExpectedDuration(paramsJSON string, inputDuration float64) float64 {
+	var params ffmpeg.TrimParams
+	if err := json.Unmarshal([]byte(paramsJSON), &params); err != nil {
+		return 0
+	}
+	return params.OutputDuration(inputDuration)
+}
+
+// thumbnailProcessor 按固定间隔截图，输出为目录
+type thumbnailProcessor struct{}
+
+func (thumbnailProcessor) Type() models.TaskType { return models.TaskTypeThumbnail }
+
+func (thumbnailProcessor) Description() string { return "生成缩略图" }
+
+func (thumbnailProcessor) Params() []ParamField {
+	return []ParamField{
+		{Name: "interval", Label: "截图间隔 (秒)", Type: ParamInt, Default: 5, Min: intPtr(1)},
+		{Name: "scale", Label: "缩略图尺寸", Type: ParamString, Default: "320x240", Placeholder: "320x240"},
+	}
+}
+
+func (p thumbnailProcessor) Validate(paramsJSON string) error {
+	_, err := validateFields(p.Params(), paramsJSON)
+	return err
+}
+
+func (thumbnailProcessor) OutputPath(inputPath, outputDir, paramsJSON string) string {
+	return filepath.Join(outputDir, baseName(inputPath)+"_thumbs")
+}
+
+func (thumbnailProcessor) OutputIsDir() bool { return true }
+
+func (thumbnailProcessor) Command(ff *ffmpeg.FFmpeg, inputPath, outputPath, paramsJSON string, callback ffmpeg.ProgressCallback) (*exec.Cmd, error) {
+	return ff.GenerateThumbnails(inputPath, outputPath, paramsJSON, callback)
+}
+
+func (thumbnailProcessor) ExpectedDuration(paramsJSON string, inputDuration float64) float64 {
+	return inputDuration
+}
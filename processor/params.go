@@ -0,0 +1,97 @@
+package processor
+
+import (
+	"fmt"
+	"math"
+	"videoforge/ffmpeg"
+)
+
+// 参数值类型
+const (
+	ParamString   = "string"
+	ParamInt      = "int"
+	ParamBool     = "bool"
+	ParamDuration = "duration" // HH:MM:SS[.ms]、MM:SS 或秒数
+)
+
+// ParamField 任务参数定义
+type ParamField struct {
+	Name        string        `json:"name"`
+	Label       string        `json:"label"`
+	Type        string        `json:"type"`
+	Default     interface{}   `json:"default,omitempty"`
+	Placeholder string        `json:"placeholder,omitempty"`
+	Options     []ParamOption `json:"options,omitempty"` // 可选值，界面显示为下拉框
+	Min         *int          `json:"min,omitempty"`     // int 参数的最小值
+	Required    bool          `json:"required,omitempty"`
+}
+
+// ParamOption 参数的可选值
+type ParamOption struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// ParamError 任务参数不合法
+type ParamError struct {
+	Field   string
+	Message string
+}
+
+func (e *ParamError) Error() string {
+	if e.Field == "" {
+		return "invalid params: " + e.Message
+	}
+	return fmt.Sprintf("invalid param %s: %s", e.Field, e.Message)
+}
+
+// intPtr 用于填写 ParamField.Min
+func intPtr(v int) *int {
+	return &v
+}
+
+// validateFields 按参数定义检查参数类型、必填项和最小值，未定义的参数不检查
+func validateFields(fields []ParamField, paramsJSON string) (map[string]interface{}, error) {
+	params, err := decodeParams(paramsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		v, ok := params[field.Name]
+		if !ok || v == nil || v == "" {
+			if field.Required {
+				return nil, &ParamError{Field: field.Name, Message: "is required"}
+			}
+			continue
+		}
+
+		switch field.Type {
+		case ParamString:
+			if _, ok := v.(string); !ok {
+				return nil, &ParamError{Field: field.Name, Message: "must be a string"}
+			}
+		case ParamBool:
+			if _, ok := v.(bool); !ok {
+				return nil, &ParamError{Field: field.Name, Message: "must be a boolean"}
+			}
+		case ParamInt:
+			n, ok := v.(float64)
+			if !ok || n != math.Trunc(n) {
+				return nil, &ParamError{Field: field.Name, Message: "must be an integer"}
+			}
+			if field.Min != nil && n < float64(*field.Min) {
+				return nil, &ParamError{Field: field.Name, Message: fmt.Sprintf("must be at least %d", *field.Min)}
+			}
+		case ParamDuration:
+			s, ok := v.(string)
+			if !ok {
+				return nil, &ParamError{Field: field.Name, Message: "must be a timestamp string"}
+			}
+			if _, err := ffmpeg.ParseTimestamp(s); err != nil {
+				return nil, &ParamError{Field: field.Name, Message: err.Error()}
+			}
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,128 @@
+// Package processor 定义任务类型的处理器。每种任务类型注册一个 Processor，
+// 负责校验参数、推导输出路径、构造 FFmpeg 命令以及说明进度的计算方式，
+// 新增操作只需实现 Processor 并注册，不必修改调度、执行和 API 代码
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"videoforge/ffmpeg"
+	"videoforge/models"
+)
+
+// ErrUnknownType 任务类型没有注册处理器
+var ErrUnknownType = errors.New("unknown task type")
+
+// Processor 任务类型的处理器
+type Processor interface {
+	// Type 处理的任务类型
+	Type() models.TaskType
+	// Description 任务类型的说明，用于界面显示
+	Description() string
+	// Params 参数定义，界面据此生成表单
+	Params() []ParamField
+	// Validate 校验 JSON 格式的任务参数
+	Validate(paramsJSON string) error
+	// OutputPath 根据输入路径、输出目录和参数推导默认输出路径
+	OutputPath(inputPath, outputDir, paramsJSON string) string
+	// OutputIsDir 输出是否为目录（例如缩略图）
+	OutputIsDir() bool
+	// Command 构造并启动 FFmpeg 进程，进度通过 callback 回调，调用方负责 Wait
+	Command(ff *ffmpeg.FFmpeg, inputPath, outputPath, paramsJSON string, callback ffmpeg.ProgressCallback) (*exec.Cmd, error)
+	// ExpectedDuration 输出的预期时长，也是计算进度的基准，无法确定时返回 0
+	ExpectedDuration(paramsJSON string, inputDuration float64) float64
+}
+
+// TypeInfo 任务类型及其参数定义，供 API 返回
+type TypeInfo struct {
+	Type        models.TaskType `json:"type"`
+	Description string          `json:"description"`
+	OutputIsDir bool            `json:"outputIsDir"`
+	Params      []ParamField    `json:"params"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[models.TaskType]Processor)
+	order      []models.TaskType
+)
+
+// Register 注册处理器，同一任务类型重复注册时后者覆盖前者
+func Register(p Processor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[p.Type()]; !ok {
+		order = append(order, p.Type())
+	}
+	registry[p.Type()] = p
+}
+
+// Get 返回任务类型的处理器，未注册时返回 ErrUnknownType
+func Get(taskType models.TaskType) (Processor, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	p, ok := registry[taskType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, taskType)
+	}
+	return p, nil
+}
+
+// List 按注册顺序返回所有任务类型的信息
+func List() []TypeInfo {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	infos := make([]TypeInfo, 0, len(order))
+	for _, t := range order {
+		p := registry[t]
+		infos = append(infos, TypeInfo{
+			Type:        t,
+			Description: p.Description(),
+			OutputIsDir: p.OutputIsDir(),
+			Params:      p.Params(),
+		})
+	}
+	return infos
+}
+
+// Validate 校验任务类型和参数
+func Validate(taskType models.TaskType, paramsJSON string) error {
+	p, err := Get(taskType)
+	if err != nil {
+		return err
+	}
+	return p.Validate(paramsJSON)
+}
+
+// Start 用任务类型的处理器启动 FFmpeg。输出为目录时先创建目录
+func Start(ff *ffmpeg.FFmpeg, task *models.Task, inputPath, outputPath string, callback ffmpeg.ProgressCallback) (*exec.Cmd, error) {
+	p, err := Get(task.Type)
+	if err != nil {
+		return nil, err
+	}
+	if p.OutputIsDir() {
+		if err := os.MkdirAll(outputPath, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return p.Command(ff, inputPath, outputPath, task.Params, callback)
+}
+
+// decodeParams 把 JSON 参数解码为 map，空参数视为没有参数
+func decodeParams(paramsJSON string) (map[string]interface{}, error) {
+	params := make(map[string]interface{})
+	if paramsJSON == "" || paramsJSON == "null" {
+		return params, nil
+	}
+	if err := json.Unmarshal([]byte(paramsJSON), &params); err != nil {
+		return nil, &ParamError{Message: "params must be a JSON object"}
+	}
+	return params, nil
+}
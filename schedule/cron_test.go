@@ -0,0 +1,56 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2026-10-20 为周二
+	after := time.Date(2026, 10, 20, 12, 7, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 10, 20, 12, 15, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2026, 10, 21, 2, 30, 0, 0, time.UTC)},
+		{"0 12 * * 1-5", time.Date(2026, 10, 21, 12, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		// 日和周都有限制时满足其一即可
+		{"0 0 1,15 * 1", time.Date(2026, 10, 26, 0, 0, 0, 0, time.UTC)},
+		// 日以 * 开头时两者都要满足：奇数日的周一
+		{"0 0 */2 * 1", time.Date(2026, 11, 9, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * */2", time.Date(2026, 10, 22, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(after); !got.Equal(tt.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", tt.expr, after, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package schedule
+
+import (
+	"log"
+	"time"
+	"videoforge/database"
+	"videoforge/models"
+)
+
+// BatchFunc 执行一个批量任务定义，返回创建的任务数
+type BatchFunc func(definition []byte) (int, error)
+
+// Runner 按 cron 表达式定时执行保存的批量任务
+type Runner struct {
+	db       *database.DB
+	runBatch BatchFunc
+}
+
+func NewRunner(db *database.DB, runBatch BatchFunc) *Runner {
+	return &Runner{
+		db:       db,
+		runBatch: runBatch,
+	}
+}
+
+// Start 启动定时检查
+func (r *Runner) Start() {
+	go r.loop()
+}
+
+func (r *Runner) loop() {
+	// 服务停止期间错过的执行不再补跑，直接顺延到下一次
+	r.skipMissed(time.Now())
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		r.runDue(now)
+	}
+}
+
+func (r *Runner) skipMissed(now time.Time) {
+	schedules, err := r.db.GetSchedules()
+	if err != nil {
+		log.Printf("Failed to load schedules: %v", err)
+		return
+	}
+
+	for _, s := range schedules {
+		if !s.Enabled || s.NextRunAt == nil || s.NextRunAt.After(now) {
+			continue
+		}
+		log.Printf("Schedule %d (%s) missed run at %s, skipping", s.ID, s.Name, s.NextRunAt.Format(time.RFC3339))
+		r.db.UpdateScheduleNextRun(s.ID, NextRun(s.Cron, now))
+	}
+}
+
+// runDue 执行所有已到期的定时任务
+func (r *Runner) runDue(now time.Time) {
+	schedules, err := r.db.GetSchedules()
+	if err != nil {
+		log.Printf("Failed to load schedules: %v", err)
+		return
+	}
+
+	for _, s := range schedules {
+		if !s.Enabled || s.NextRunAt == nil || s.NextRunAt.After(now) {
+			continue
+		}
+		r.run(s, now)
+	}
+}
+
+func (r *Runner) run(s *models.Schedule, now time.Time) {
+	lastError := ""
+	count, err := r.runBatch(s.Batch)
+	if err != nil {
+		lastError = err.Error()
+		log.Printf("Schedule %d (%s) failed: %v", s.ID, s.Name, err)
+	} else {
+		log.Printf("Schedule %d (%s) queued %d tasks", s.ID, s.Name, count)
+	}
+
+	if err := r.db.UpdateScheduleRun(s.ID, now, NextRun(s.Cron, now), lastError); err != nil {
+		log.Printf("Failed to update schedule %d: %v", s.ID, err)
+	}
+}
+
+// NextRun 计算 cron 表达式在 after 之后的下一次执行时间，表达式无效时返回 nil
+func NextRun(expr string, after time.Time) *time.Time {
+	c, err := ParseCron(expr)
+	if err != nil {
+		return nil
+	}
+	next := c.Next(after)
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
@@ -0,0 +1,99 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeWindow 允许启动任务的每日时间窗口，例如只在 01:00-07:00 运行转码。
+// End 早于 Start 时表示跨越午夜（例如 22:00-06:00）
+type TimeWindow struct {
+	Types []string `json:"types"` // 适用的任务类型，为空表示所有类型
+	Start string   `json:"start"` // HH:MM
+	End   string   `json:"end"`   // HH:MM
+}
+
+// Validate 校验时间格式
+func (w TimeWindow) Validate() error {
+	if _, err := parseClock(w.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(w.End); err != nil {
+		return err
+	}
+	return nil
+}
+
+// appliesTo 窗口是否约束该任务类型
+func (w TimeWindow) appliesTo(taskType string) bool {
+	if len(w.Types) == 0 {
+		return true
+	}
+	for _, t := range w.Types {
+		if t == taskType {
+			return true
+		}
+	}
+	return false
+}
+
+// contains 判断时间点是否落在窗口内
+func (w TimeWindow) contains(t time.Time) bool {
+	start, err1 := parseClock(w.Start)
+	end, err2 := parseClock(w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if start == end {
+		return true
+	}
+	if start < end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// nextStart 返回 t 之后窗口下一次开始的时间
+func (w TimeWindow) nextStart(t time.Time) time.Time {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return time.Time{}
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	next := midnight.Add(start)
+	if !next.After(t) {
+		next = midnight.AddDate(0, 0, 1).Add(start)
+	}
+	return next
+}
+
+// WindowsAllow 判断该类型的任务此刻能否启动。
+// 没有适用的窗口时不受限制；否则必须落在任一窗口内，不允许时同时返回最近的开放时间
+func WindowsAllow(windows []TimeWindow, taskType string, t time.Time) (bool, time.Time) {
+	var nextOpen time.Time
+	restricted := false
+	for _, w := range windows {
+		if !w.appliesTo(taskType) {
+			continue
+		}
+		restricted = true
+		if w.contains(t) {
+			return true, time.Time{}
+		}
+		if next := w.nextStart(t); !next.IsZero() && (nextOpen.IsZero() || next.Before(nextOpen)) {
+			nextOpen = next
+		}
+	}
+	return !restricted, nextOpen
+}
+
+// parseClock 解析 HH:MM，返回距当天零点的时长
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
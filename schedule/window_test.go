@@ -0,0 +1,38 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowsAllow(t *testing.T) {
+	windows := []TimeWindow{
+		{Types: []string{"transcode"}, Start: "01:00", End: "07:00"},
+		{Types: []string{"remux"}, Start: "22:00", End: "06:00"},
+	}
+	day := func(hour, minute int) time.Time {
+		return time.Date(2026, 10, 20, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		taskType string
+		at       time.Time
+		allowed  bool
+		nextOpen time.Time
+	}{
+		{"transcode", day(3, 0), true, time.Time{}},
+		{"transcode", day(7, 0), false, day(25, 0)},
+		{"transcode", day(0, 30), false, day(1, 0)},
+		// 跨越午夜的窗口
+		{"remux", day(23, 0), true, time.Time{}},
+		{"remux", day(5, 59), true, time.Time{}},
+		{"remux", day(12, 0), false, day(22, 0)},
+		// 没有适用的窗口时不受限制
+		{"thumbnail", day(12, 0), true, time.Time{}},
+	}
+	for _, tt := range tests {
+		allowed, next := WindowsAllow(windows, tt.taskType, tt.at)
+		if allowed != tt.allowed || !next.Equal(tt.nextOpen) {
+			t.Errorf("WindowsAllow(%s, %v) = %v, %v; want %v, %v", tt.taskType, tt.at, allowed, next, tt.allowed, tt.nextOpen)
+		}
+	}
+}
@@ -2,12 +2,13 @@
 let ws = null;
 let currentPath = '';
 let tasks = [];
+let queuePositions = {}; // 等待中任务的排队位置，按任务 ID 索引
 
 // 初始化
 document.addEventListener('DOMContentLoaded', () => {
     connectWebSocket();
     refreshTasks();
-    updateTaskTypeParams();
+    loadTaskTypes();
     browsePath(); // 加载上次浏览的目录
     
     // 任务类型切换时更新参数表单
@@ -208,97 +209,95 @@ function escapeHtml(text) {
     return div.innerHTML.replace(/'/g, "\\'");
 }
 
-// 更新任务参数表单
-function updateTaskTypeParams() {
+// 已注册的任务类型及参数定义，由 /api/task-types 返回
+let taskTypes = [];
+
+// 加载任务类型，填充任务类型下拉框
+async function loadTaskTypes() {
+    try {
+        const response = await fetch('/videoforge/api/task-types');
+        taskTypes = await response.json();
+    } catch (error) {
+        console.error('加载任务类型失败:', error);
+        return;
+    }
+
+    const select = document.getElementById('batchTaskType');
+    const selected = select.value;
+    select.innerHTML = taskTypes.map(t =>
+        `<option value="${t.type}">${escapeHtml(t.description || t.type)}</option>`
+    ).join('');
+    if (taskTypes.some(t => t.type === selected)) {
+        select.value = selected;
+    }
+    updateTaskTypeParams();
+}
+
+// 当前选中任务类型的参数定义
+function currentParamFields() {
     const taskType = document.getElementById('batchTaskType').value;
+    const info = taskTypes.find(t => t.type === taskType);
+    return info ? info.params || [] : [];
+}
+
+// 按参数定义生成参数表单
+function updateTaskTypeParams() {
     const paramsForm = document.getElementById('taskParamsForm');
-    
-    let html = '';
-    
-    if (taskType === 'transcode') {
-        html = `
-            <div class="param-input">
-                <label>视频编码:</label>
-                <select id="videoCodec">
-                    <option value="libx264">H.264</option>
-                    <option value="libx265">H.265</option>
-                    <option value="libvpx-vp9">VP9</option>
-                </select>
-            </div>
-            <div class="param-input">
-                <label>音频编码:</label>
-                <select id="audioCodec">
-                    <option value="aac">AAC</option>
-                    <option value="libmp3lame">MP3</option>
-                </select>
-            </div>
-            <div class="param-input">
-                <label>比特率:</label>
-                <input type="text" id="bitrate" placeholder="例如: 2M" value="2M">
-            </div>
-            <div class="param-input">
-                <label>分辨率:</label>
-                <input type="text" id="resolution" placeholder="例如: 1920x1080">
-            </div>
-        `;
-    } else if (taskType === 'remux') {
-        html = `
-            <div class="param-input">
-                <label>目标封装格式:</label>
-                <select id="outputExtension">
-                    <option value="mp4">MP4</option>
-                    <option value="flv">FLV</option>
-                    <option value="m3u8">M3U8(HLS)</option>
-                </select>
-            </div>
-        `;
-    } else if (taskType === 'trim') {
-        html = `
-            <div class="param-input">
-                <label>起始时间 (HH:MM:SS):</label>
-                <input type="text" id="startTime" placeholder="00:00:00" value="00:00:00">
-            </div>
-            <div class="param-input">
-                <label>持续时间 (HH:MM:SS):</label>
-                <input type="text" id="duration" placeholder="00:05:00" value="00:05:00">
-            </div>
-        `;
-    } else if (taskType === 'thumbnail') {
-        html = `
-            <div class="param-input">
-                <label>截图间隔 (秒):</label>
-                <input type="number" id="interval" value="5" min="1">
-            </div>
+
+    paramsForm.innerHTML = currentParamFields().map(field => {
+        const id = `param_${field.name}`;
+        const value = field.default !== undefined ? field.default : '';
+
+        if (field.type === 'bool') {
+            return `
+            <label>
+                <input type="checkbox" id="${id}" ${value === true ? 'checked' : ''}>
+                ${escapeHtml(field.label)}
+            </label>`;
+        }
+
+        let input;
+        if (field.options && field.options.length) {
+            input = `<select id="${id}">` + field.options.map(o =>
+                `<option value="${escapeHtml(o.value)}" ${o.value === value ? 'selected' : ''}>${escapeHtml(o.label)}</option>`
+            ).join('') + `</select>`;
+        } else if (field.type === 'int') {
+            const min = field.min !== undefined ? `min="${field.min}"` : '';
+            input = `<input type="number" id="${id}" value="${value}" ${min}>`;
+        } else {
+            input = `<input type="text" id="${id}" placeholder="${escapeHtml(field.placeholder || '')}" value="${escapeHtml(String(value))}">`;
+        }
+        return `
             <div class="param-input">
-                <label>缩略图尺寸:</label>
-                <input type="text" id="scale" placeholder="320x240" value="320x240">
-            </div>
-        `;
-    }
-    
-    paramsForm.innerHTML = html;
+                <label>${escapeHtml(field.label)}:</label>
+                ${input}
+            </div>`;
+    }).join('');
 }
 
-// 获取任务参数
+// 获取任务参数，空值不提交
 function getTaskParams() {
-    const taskType = document.getElementById('batchTaskType').value;
     const params = {};
-    
-    if (taskType === 'transcode') {
-        params.videoCodec = document.getElementById('videoCodec').value;
-        params.audioCodec = document.getElementById('audioCodec').value;
-        params.bitrate = document.getElementById('bitrate').value;
-        params.resolution = document.getElementById('resolution').value;
-    } else if (taskType === 'remux') {
-        params.outputExtension = document.getElementById('outputExtension').value;
-    } else if (taskType === 'trim') {
-        params.startTime = document.getElementById('startTime').value;
-        params.duration = document.getElementById('duration').value;
-    } else if (taskType === 'thumbnail') {
-        params.interval = parseInt(document.getElementById('interval').value);
-        params.scale = document.getElementById('scale').value;
-    }
-    
+
+    currentParamFields().forEach(field => {
+        const el = document.getElementById(`param_${field.name}`);
+        if (!el) {
+            return;
+        }
+        if (field.type === 'bool') {
+            if (el.checked) {
+                params[field.name] = true;
+            }
+        } else if (field.type === 'int') {
+            const value = parseInt(el.value);
+            if (!isNaN(value)) {
+                params[field.name] = value;
+            }
+        } else if (el.value !== '') {
+            params[field.name] = el.value;
+        }
+    });
+
     return params;
 }
 
@@ -334,7 +333,8 @@ async function batchAddTasks() {
         const data = await response.json();
         
         if (response.ok) {
-            alert(`成功添加 ${data.count} 个任务！`);
+            const skipped = data.duplicates && data.duplicates.length ? `，跳过 ${data.duplicates.length} 个重复任务` : '';
+            alert(`成功添加 ${data.count} 个任务${skipped}！`);
             refreshTasks();
         } else {
             alert(`错误: ${data.error}`);
@@ -351,18 +351,6 @@ async function addSingleTask(inputPath) {
     const deleteOriginal = document.getElementById('batchDeleteOriginal').checked;
     const params = getTaskParams();
 
-    // 生成输出路径
-    let outputPath;
-    if (taskType === 'remux') {
-        const fileName = inputPath.split(/[\\/]/).pop();
-        const nameWithoutExt = fileName.replace(/\.[^/.]+$/, '');
-        const outputExt = params.outputExtension ? `.${params.outputExtension}` : '.mp4';
-        outputPath = `./output/${nameWithoutExt}${outputExt}`;
-    } else {
-        const fileName = inputPath.split(/[\\/]/).pop();
-        outputPath = `./output/${fileName}`;
-    }
-
     try {
         const response = await fetch('/videoforge/api/tasks', {
             method: 'POST',
@@ -371,7 +359,6 @@ async function addSingleTask(inputPath) {
             },
             body: JSON.stringify({
                 inputPath,
-                outputPath,
                 type: taskType,
                 params,
                 deleteOriginal
@@ -380,7 +367,10 @@ async function addSingleTask(inputPath) {
         
         const data = await response.json();
         
-        if (response.ok) {
+        if (response.status === 200) {
+            alert(data.skipped ? `输出文件已存在，已跳过: ${data.conflict.outputPath}` : `相同的任务已存在（任务 ${data.id}）`);
+            refreshTasks();
+        } else if (response.ok) {
             alert('任务已添加！');
             refreshTasks();
         } else {
@@ -405,6 +395,10 @@ function updateTaskInList(update) {
         if (update.status === 'error' && update.message) {
             tasks[taskIndex].errorLog = update.message;
         }
+        if (update.status === 'waiting_resources' && update.message) {
+            tasks[taskIndex].waitingReason = update.message;
+        }
+        tasks[taskIndex].errorCode = update.errorCode || '';
         
         // 重新渲染任务列表
         displayTasks();
@@ -422,6 +416,7 @@ async function refreshTasks() {
         
         if (response.ok) {
             tasks = data || [];
+            await loadQueuePositions();
             displayTasks();
         }
     } catch (error) {
@@ -429,6 +424,34 @@ async function refreshTasks() {
     }
 }
 
+// 加载等待中任务的排队位置（按公平调度顺序估算）
+async function loadQueuePositions() {
+    try {
+        const response = await fetch('/videoforge/api/queue/positions');
+        if (!response.ok) {
+            return;
+        }
+        const positions = await response.json();
+        queuePositions = {};
+        positions.forEach(p => { queuePositions[p.taskId] = p; });
+    } catch (error) {
+        console.error('加载排队位置失败:', error);
+    }
+}
+
+// 排队位置说明，例如“排队第 3 位，预计 4 分钟后开始”
+function formatQueuePosition(task) {
+    const p = queuePositions[task.id];
+    if (!p || !['pending', 'waiting_resources'].includes(task.status)) {
+        return '';
+    }
+    let text = `排队第 ${p.position} 位`;
+    if (p.estimatedWait !== undefined) {
+        text += p.estimatedWait < 60 ? '，即将开始' : `，预计 ${Math.round(p.estimatedWait / 60)} 分钟后开始`;
+    }
+    return text;
+}
+
 // 显示任务列表
 function displayTasks() {
     const tasksList = document.getElementById('tasksList');
@@ -451,7 +474,12 @@ function displayTasks() {
             'pending': '等待中',
             'running': '处理中',
             'finished': '已完成',
-            'error': '失败'
+            'error': '失败',
+            'paused': '已暂停',
+            'interrupted': '已中断',
+            'waiting_resources': '等待资源',
+            'canceled': '已取消',
+            'skipped': '已跳过'
         }[task.status] || task.status;
         
         const typeText = {
@@ -470,8 +498,11 @@ function displayTasks() {
                 <div class="task-path">
                     <strong>输入:</strong> ${task.inputPath}<br>
                     <strong>输出:</strong> ${task.outputPath}
+                    ${task.workerId ? `<br><strong>Worker:</strong> ${task.workerId}` : ''}
+                    ${task.owner ? `<br><strong>提交者:</strong> ${escapeHtml(task.owner)}` : ''}
+                    ${formatQueuePosition(task) ? `<br><small>${formatQueuePosition(task)}</small>` : ''}
                 </div>
-                ${task.status === 'running' || task.status === 'finished' ? `
+                ${task.status === 'running' || task.status === 'finished' || task.status === 'paused' ? `
                     <div class="task-progress">
                         <div class="task-progress-bar">
                             <div class="task-progress-fill" style="width: ${task.progress}%"></div>
@@ -479,15 +510,27 @@ function displayTasks() {
                         <small>${task.progress.toFixed(1)}%</small>
                     </div>
                 ` : ''}
-                ${task.status === 'error' ? `
+                ${['error', 'canceled', 'skipped'].includes(task.status) || (task.status === 'waiting_resources' && !task.waitingReason) ? `
                     <div style="color: #ef4444; font-size: 12px; margin-top: 5px;">
-                        ${task.errorLog}
+                        ${task.errorCode ? `<strong>[${task.errorCode}]</strong> ` : ''}${task.errorLog}
                     </div>
                 ` : ''}
+                ${task.status === 'waiting_resources' && task.waitingReason ? `
+                    <div style="color: #f59e0b; font-size: 12px; margin-top: 5px;">${task.waitingReason}</div>
+                ` : ''}
                 <div class="task-actions">
                     ${task.status === 'finished' ? `
                         <button onclick="previewVideo('${escapeHtml(task.outputPath)}', '处理后的视频')">预览结果</button>
                     ` : ''}
+                    ${task.status === 'running' || task.status === 'pending' ? `
+                        <button onclick="pauseTask(${task.id})">暂停</button>
+                    ` : ''}
+                    ${task.status === 'paused' ? `
+                        <button onclick="resumeTask(${task.id})">继续</button>
+                    ` : ''}
+                    ${['pending', 'running', 'paused', 'interrupted', 'waiting_resources'].includes(task.status) ? `
+                        <button onclick="cancelTask(${task.id})">取消</button>
+                    ` : ''}
                     <button onclick="deleteTask(${task.id})">删除</button>
                 </div>
             </div>
@@ -528,6 +571,46 @@ async function deleteTask(taskId, deleteOutput = true) {
     }
 }
 
+// 暂停任务
+async function pauseTask(taskId) {
+    await postTaskAction(taskId, 'pause', '暂停失败');
+}
+
+// 恢复任务
+async function resumeTask(taskId) {
+    await postTaskAction(taskId, 'resume', '恢复失败');
+}
+
+// 取消任务，保留任务记录和临时输出
+async function cancelTask(taskId) {
+    if (!confirm('确定要取消此任务吗？')) {
+        return;
+    }
+    await postTaskAction(taskId, 'cancel', '取消失败');
+}
+
+async function postTaskAction(taskId, action, failMessage) {
+    try {
+        const response = await fetch(`/videoforge/api/tasks/${taskId}/${action}`, {
+            method: 'POST'
+        });
+        const data = await response.json();
+
+        if (response.ok) {
+            const taskIndex = tasks.findIndex(t => t.id === taskId);
+            if (taskIndex !== -1) {
+                tasks[taskIndex] = data;
+            }
+            displayTasks();
+        } else {
+            alert(`${failMessage}: ${data.error || ''}`);
+        }
+    } catch (error) {
+        console.error(`${failMessage}:`, error);
+        alert(failMessage);
+    }
+}
+
 // 清除已完成的任务
 async function clearFinishedTasks() {
     const finishedTasks = tasks.filter(t => t.status === 'finished');
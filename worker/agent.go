@@ -0,0 +1,365 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"videoforge/config"
+	"videoforge/ffmpeg"
+	"videoforge/models"
+	"videoforge/processor"
+)
+
+// agentHeartbeatInterval 远程 worker 发送心跳（同时上报进度）的间隔
+const agentHeartbeatInterval = 2 * time.Second
+
+// Agent videoforge worker 模式：从中心服务器领取任务，用本机 FFmpeg 执行并上报进度
+type Agent struct {
+	cfg    config.AgentConfig
+	id     string
+	ffmpeg *ffmpeg.FFmpeg
+	client *http.Client
+
+	mu       sync.Mutex
+	stopping bool
+	running  map[int64]*agentTask
+	wg       sync.WaitGroup
+}
+
+// agentTask 远程 worker 正在执行的任务，由 Agent.mu 保护
+type agentTask struct {
+	cmd          *exec.Cmd
+	progress     float64
+	message      string
+	lost         bool // 租约已失效（任务被删除、过期或服务器重启）
+	canceled     bool // 任务已被取消，保留临时输出
+	interrupted  bool // worker 停止时被终止
+	verification *models.VerifyResult
+}
+
+// NewAgent 创建远程 worker
+func NewAgent(cfg config.AgentConfig, ffmpegPath string, threads int) *Agent {
+	id := cfg.ID
+	if id == "" {
+		id, _ = os.Hostname()
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5
+	}
+
+	return &Agent{
+		cfg:     cfg,
+		id:      id,
+		ffmpeg:  ffmpeg.NewFFmpeg(ffmpegPath, threads),
+		client:  &http.Client{Timeout: 30 * time.Second},
+		running: make(map[int64]*agentTask),
+	}
+}
+
+// Run 启动 cfg.Concurrency 个领取循环
+func (a *Agent) Run() {
+	log.Printf("Worker %s connecting to %s, concurrency %d", a.id, a.cfg.Server, a.cfg.Concurrency)
+	for i := 0; i < a.cfg.Concurrency; i++ {
+		a.wg.Add(1)
+		go a.loop()
+	}
+}
+
+// Shutdown 停止领取新任务，等待运行中的任务在 grace 内结束；
+// 超时后终止剩余的 FFmpeg 进程并把任务交还服务器
+func (a *Agent) Shutdown(grace time.Duration) {
+	a.mu.Lock()
+	a.stopping = true
+	a.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-time.After(grace):
+	}
+
+	a.mu.Lock()
+	for id, t := range a.running {
+		t.interrupted = true
+		log.Printf("Interrupting task %d", id)
+		if t.cmd != nil {
+			killProcess(t.cmd.Process)
+		}
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		log.Printf("Some tasks did not exit in time")
+	}
+}
+
+func (a *Agent) loop() {
+	defer a.wg.Done()
+
+	for {
+		a.mu.Lock()
+		stopping := a.stopping
+		a.mu.Unlock()
+		if stopping {
+			return
+		}
+
+		claim, err := a.claim()
+		if err != nil {
+			log.Printf("Failed to claim task: %v", err)
+		}
+		if claim == nil {
+			time.Sleep(time.Duration(a.cfg.PollInterval) * time.Second)
+			continue
+		}
+
+		a.runTask(claim.Task)
+	}
+}
+
+// claim 向服务器领取任务，没有可领取的任务时返回 nil
+func (a *Agent) claim() (*models.ClaimResponse, error) {
+	req := models.ClaimRequest{WorkerID: a.id, Host: hostname, Types: a.cfg.Types}
+	for _, m := range a.cfg.PathMappings {
+		req.PathPrefixes = append(req.PathPrefixes, m.Server)
+	}
+
+	var resp models.ClaimResponse
+	status, err := a.post("/api/agent/claim", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNoContent || resp.Task == nil {
+		return nil, nil
+	}
+	return &resp, nil
+}
+
+// runTask 执行领取到的任务，期间定时发送心跳，结束后上报结果
+func (a *Agent) runTask(task *models.Task) {
+	log.Printf("Processing task %d: %s (%s)", task.ID, task.InputPath, task.Type)
+
+	t := &agentTask{}
+	a.mu.Lock()
+	a.running[task.ID] = t
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.running, task.ID)
+		a.mu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go a.heartbeat(task.ID, t, done)
+	runErr := a.execute(task, t)
+	close(done)
+
+	a.mu.Lock()
+	lost, canceled, interrupted := t.lost, t.canceled, t.interrupted
+	a.mu.Unlock()
+
+	switch {
+	case canceled:
+		log.Printf("Task %d canceled, partial output kept", task.ID)
+	case lost:
+		log.Printf("Task %d lease lost, result discarded", task.ID)
+	case interrupted:
+		if _, err := a.post(fmt.Sprintf("/api/agent/tasks/%d/release", task.ID), models.Heartbeat{WorkerID: a.id}, nil); err != nil {
+			log.Printf("Failed to release task %d: %v", task.ID, err)
+		}
+	default:
+		result := models.TaskResult{WorkerID: a.id, Verification: t.verification}
+		if runErr != nil {
+			log.Printf("Task %d failed: %v", task.ID, runErr)
+			result.Error = runErr.Error()
+			result.ErrorClass = classifyError(runErr)
+		} else {
+			log.Printf("Task %d completed successfully", task.ID)
+		}
+		if _, err := a.post(fmt.Sprintf("/api/agent/tasks/%d/complete", task.ID), result, nil); err != nil {
+			log.Printf("Failed to report result of task %d: %v", task.ID, err)
+		}
+	}
+}
+
+// execute 把任务路径映射为本机路径后运行 FFmpeg 并等待结束
+func (a *Agent) execute(task *models.Task, t *agentTask) error {
+	inputPath := a.localPath(task.InputPath)
+	outputPath := a.localPath(task.OutputPath)
+
+	input, err := os.Open(inputPath)
+	if err != nil {
+		return err
+	}
+	input.Close()
+	if err := ffmpeg.PreparePartial(outputPath); err != nil {
+		return err
+	}
+
+	progressCallback := func(progress float64, message string) {
+		a.mu.Lock()
+		t.progress = progress
+		t.message = message
+		a.mu.Unlock()
+	}
+
+	// 与本机执行相同，输出先写入临时路径，成功后再重命名
+	// FFmpeg 日志保存在 worker 本机，失败时最后几行错误输出随结果上报
+	partialPath := ffmpeg.PartialPath(outputPath)
+	tlog := openTaskLog(task, hostname)
+	if tlog != nil {
+		defer tlog.Close()
+	}
+	cmd, err := processor.Start(a.ffmpeg.WithLog(tlog), task, inputPath, partialPath, progressCallback)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	t.cmd = cmd
+	if t.lost || t.canceled || t.interrupted {
+		killProcess(cmd.Process)
+	}
+	a.mu.Unlock()
+	log.Printf("Task %d ffmpeg started, PID: %d", task.ID, cmd.Process.Pid)
+
+	err = withStderr(cmd.Wait(), tlog)
+	a.mu.Lock()
+	canceled := t.canceled
+	stopped := t.lost || canceled || t.interrupted
+	a.mu.Unlock()
+	if err == nil && !stopped && verifyEnabled() {
+		result := verifyOutput(a.ffmpeg, task, inputPath, partialPath)
+		a.mu.Lock()
+		t.verification = result
+		a.mu.Unlock()
+		if !result.Passed {
+			err = &VerifyError{Reason: result.Message}
+		}
+	}
+	if err == nil && !stopped {
+		err = ffmpeg.CommitOutput(partialPath, outputPath)
+	}
+	// 与本机执行相同，取消时保留临时输出便于排查，租约失效或 worker 停止时删除
+	if canceled {
+		return err
+	}
+	if err != nil || stopped {
+		ffmpeg.DiscardOutput(partialPath, outputPath)
+	}
+	return err
+}
+
+// heartbeat 定时续约并上报进度，租约失效时终止 FFmpeg
+func (a *Agent) heartbeat(id int64, t *agentTask, done <-chan struct{}) {
+	ticker := time.NewTicker(agentHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		a.mu.Lock()
+		hb := models.Heartbeat{WorkerID: a.id, Progress: t.progress, Message: t.message}
+		a.mu.Unlock()
+
+		_, err := a.post(fmt.Sprintf("/api/agent/tasks/%d/heartbeat", id), hb, nil)
+		if errors.Is(err, ErrLeaseCanceled) || errors.Is(err, ErrLeaseLost) {
+			a.mu.Lock()
+			if errors.Is(err, ErrLeaseCanceled) {
+				log.Printf("Task %d canceled, killing ffmpeg", id)
+				t.canceled = true
+			} else {
+				log.Printf("Task %d lease lost, killing ffmpeg", id)
+				t.lost = true
+			}
+			if t.cmd != nil {
+				killProcess(t.cmd.Process)
+			}
+			a.mu.Unlock()
+			return
+		}
+		if err != nil {
+			// 网络暂时中断时继续重试，租约到期前恢复即可
+			log.Printf("Heartbeat of task %d failed: %v", id, err)
+		}
+	}
+}
+
+// localPath 按路径映射把服务器路径转换为本机路径。服务器和 worker 的操作系统可能不同，
+// 比较前统一使用 / 作为分隔符
+func (a *Agent) localPath(serverPath string) string {
+	path := strings.ReplaceAll(serverPath, "\\", "/")
+	for _, m := range a.cfg.PathMappings {
+		prefix := strings.TrimSuffix(strings.ReplaceAll(m.Server, "\\", "/"), "/")
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+			continue
+		}
+		rel := strings.TrimPrefix(path[len(prefix):], "/")
+		return filepath.Join(m.Local, filepath.FromSlash(rel))
+	}
+	return serverPath
+}
+
+// post 向服务器发送 JSON 请求。410 表示任务已被取消，返回 ErrLeaseCanceled；
+// 409 表示租约已失效，返回 ErrLeaseLost
+func (a *Agent) post(path string, body interface{}, out interface{}) (int, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(a.cfg.Server, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if a.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.cfg.Token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return resp.StatusCode, ErrLeaseCanceled
+	case resp.StatusCode == http.StatusConflict:
+		return resp.StatusCode, ErrLeaseLost
+	case resp.StatusCode >= 300:
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return resp.StatusCode, fmt.Errorf("server returned %d: %s", resp.StatusCode, e.Error)
+	case out != nil && resp.StatusCode != http.StatusNoContent:
+		return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"videoforge/ffmpeg"
+	"videoforge/models"
+)
+
+// Cancel 取消任务：停止 FFmpeg 进程并把状态设为 canceled，保留任务记录、日志和临时输出，
+// 依赖该任务的下游任务一并取消
+func (tq *TaskQueue) Cancel(id int64, reason string) error {
+	if reason == "" {
+		reason = "canceled by user"
+	}
+	if err := tq.cancel(id, reason); err != nil {
+		return err
+	}
+
+	tq.CancelDependents(id, fmt.Sprintf("upstream task %d canceled", id))
+	return nil
+}
+
+// cancel 取消单个任务，任务已结束时返回 ErrTaskNotActive
+func (tq *TaskQueue) cancel(id int64, reason string) error {
+	task, err := tq.db.GetTask(id)
+	if err != nil {
+		return err
+	}
+	switch task.Status {
+	case models.TaskStatusPending, models.TaskStatusRunning, models.TaskStatusPaused,
+		models.TaskStatusInterrupted, models.TaskStatusWaitingRes:
+	default:
+		return ErrTaskNotActive
+	}
+
+	// 先写入数据库，服务在取消过程中重启也不会重新执行
+	if err := tq.db.SetTaskCanceled(id, reason); err != nil {
+		return err
+	}
+
+	if err := tq.CancelTask(id); err != nil {
+		log.Printf("Failed to stop task %d: %v", id, err)
+	}
+	tq.ForgetCanceled(id)
+
+	log.Printf("Task %d canceled: %s", id, reason)
+	tq.recordEvent(task, models.TaskEventCanceled, reason)
+	tq.notifyProgress(models.ProgressUpdate{
+		TaskID:   id,
+		Progress: task.Progress,
+		Status:   string(models.TaskStatusCanceled),
+		FileName: filepath.Base(task.InputPath),
+		Message:  reason,
+	})
+	return nil
+}
+
+// ForgetCanceled 任务已取消或从数据库删除后调用。尚未被领取的任务不会再进入 processTask
+// （领取时会检查取消状态，已删除的任务无法领取），不需要保留 CancelTask 设置的取消标记
+func (tq *TaskQueue) ForgetCanceled(id int64) {
+	if !tq.isDispatched(id) {
+		tq.cancelMu.Lock()
+		delete(tq.canceledTasks, id)
+		tq.cancelMu.Unlock()
+	}
+}
+
+// keepCanceled 记录运行中被取消的任务的最终状态。临时输出和分段工作目录保留以便排查，
+// 任务已被删除时一并清理
+func (tq *TaskQueue) keepCanceled(task *models.Task, partialPath string, progress float64) {
+	if _, err := tq.db.GetTask(task.ID); err != nil {
+		tq.DiscardTaskFiles(task)
+		return
+	}
+
+	tq.db.SetTaskStatus(task.ID, models.TaskStatusCanceled)
+	tq.db.UpdateTaskProgress(task.ID, progress)
+	log.Printf("Task %d canceled, partial output kept at %s", task.ID, partialPath)
+}
+
+// DiscardTaskFiles 删除任务的临时输出、分段工作目录和 FFmpeg 日志
+func (tq *TaskQueue) DiscardTaskFiles(task *models.Task) {
+	if err := ffmpeg.DiscardOutput(ffmpeg.PartialPath(task.OutputPath), task.OutputPath); err != nil {
+		log.Printf("Failed to remove partial output of task %d: %v", task.ID, err)
+	}
+	tq.removeWorkDir(task.ID)
+	removeTaskLogs(task.ID)
+}
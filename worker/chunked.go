@@ -0,0 +1,355 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"videoforge/config"
+	"videoforge/ffmpeg"
+	"videoforge/models"
+	"videoforge/processor"
+)
+
+// errTaskStopped 任务已被取消、中断或超时，不再启动新的 FFmpeg 进程
+var errTaskStopped = errors.New("task stopped")
+
+// workDirFor 分段转码的任务工作目录
+func workDirFor(taskID int64) string {
+	root := config.GlobalConfig.Worker.WorkDir
+	if root == "" {
+		root = filepath.Join(os.TempDir(), "videoforge")
+	}
+	return filepath.Join(root, fmt.Sprintf("task_%d", taskID))
+}
+
+// removeWorkDir 删除任务的工作目录和分段记录
+func (tq *TaskQueue) removeWorkDir(taskID int64) {
+	if err := tq.db.DeleteTaskSegments(taskID); err != nil {
+		log.Printf("Failed to delete segments of task %d: %v", taskID, err)
+	}
+	if err := os.RemoveAll(workDirFor(taskID)); err != nil {
+		log.Printf("Failed to remove work dir of task %d: %v", taskID, err)
+	}
+}
+
+// stoppedLocked 任务是否已被取消、中断、超时或因某个分段失败而终止，调用方需持有 cancelMu
+func (tq *TaskQueue) stoppedLocked(rt *runningTask) bool {
+	return rt.interrupted || rt.failed || rt.timeoutReason != "" || tq.canceledTasks[rt.task.ID]
+}
+
+// runCmd 启动一个 FFmpeg 进程并等待其结束。分段转码会在同一任务中运行多个进程，
+// 每个进程都登记到 rt 上，以便暂停、取消和超时检测作用于所有进程。
+// started 可选，在进程启动后以 PID 调用
+func (tq *TaskQueue) runCmd(rt *runningTask, start func() (*exec.Cmd, error), started func(pid int)) error {
+	tq.cancelMu.Lock()
+	stopped := tq.stoppedLocked(rt)
+	tq.cancelMu.Unlock()
+	if stopped {
+		return errTaskStopped
+	}
+
+	cmd, err := start()
+	if err != nil {
+		log.Printf("Task %d failed to start ffmpeg: %v", rt.task.ID, err)
+		return err
+	}
+
+	tq.cancelMu.Lock()
+	rt.cmds[cmd] = struct{}{}
+	firstStart := !rt.started
+	rt.started = true
+	if tq.stoppedLocked(rt) {
+		// 启动期间任务被取消或中断
+		killProcess(cmd.Process)
+	} else if rt.paused {
+		// 暂停发生在进程启动之前，新进程启动后立即挂起
+		if err := suspendProcess(cmd.Process); err != nil {
+			log.Printf("Failed to suspend task %d: %v", rt.task.ID, err)
+		}
+	}
+	tq.cancelMu.Unlock()
+
+	log.Printf("Task %d ffmpeg started, PID: %d", rt.task.ID, cmd.Process.Pid)
+	tq.db.SetTaskPID(rt.task.ID, cmd.Process.Pid)
+	if firstStart {
+		tq.saveEvent(&models.TaskEvent{TaskID: rt.task.ID, Event: models.TaskEventStarted, Attempt: rt.task.Attempts, PID: cmd.Process.Pid, Host: hostname})
+	}
+	if started != nil {
+		started(cmd.Process.Pid)
+	}
+
+	err = withStderr(cmd.Wait(), rt.ff.Log)
+
+	// 还有其他进程在运行时，记录其中一个的 PID
+	tq.cancelMu.Lock()
+	delete(rt.cmds, cmd)
+	pid := 0
+	for other := range rt.cmds {
+		pid = other.Process.Pid
+		break
+	}
+	tq.cancelMu.Unlock()
+	tq.db.SetTaskPID(rt.task.ID, pid)
+	return err
+}
+
+// chunkedParams 返回转码任务的参数以及是否使用分段模式，其他任务类型返回 false
+func chunkedParams(task *models.Task) (ffmpeg.TranscodeParams, bool) {
+	if task.Type != models.TaskTypeTranscode {
+		return ffmpeg.TranscodeParams{}, false
+	}
+	params, err := ffmpeg.ParseTranscodeParams(task.Params)
+	return params, err == nil && params.IsChunked()
+}
+
+// runChunked 分段转码：切分输入、转码未完成的分段、合并输出到 outputPath。
+// 分段记录保存在数据库中，服务重启或重试后跳过已完成的分段；
+// params.Parallel 大于 1 时多个分段在 chunkSlots 预算内并行转码
+func (tq *TaskQueue) runChunked(rt *runningTask, params ffmpeg.TranscodeParams, outputPath string, callback ffmpeg.ProgressCallback) error {
+	task := rt.task
+	workDir := workDirFor(task.ID)
+
+	segments, err := tq.db.GetTaskSegments(task.ID)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		// 分段只保留第一个视频流和音频流，有多条音轨或字幕时按普通转码执行，避免丢失轨道
+		var duration float64
+		if info, err := tq.ffmpeg.Probe(task.InputPath); err == nil {
+			if info.Audio > 1 || info.Subtitle > 0 {
+				log.Printf("Task %d input has %d audio and %d subtitle streams, transcoding without segments", task.ID, info.Audio, info.Subtitle)
+				return tq.runCmd(rt, func() (*exec.Cmd, error) {
+					return processor.Start(rt.ff, task, task.InputPath, outputPath, callback)
+				}, nil)
+			}
+			duration = info.Duration
+		}
+		segments, err = tq.splitSegments(rt, workDir, params.SegmentSeconds(duration), callback)
+		if err != nil {
+			return err
+		}
+	} else {
+		finished := 0
+		for _, seg := range segments {
+			if seg.Done {
+				finished++
+			}
+		}
+		log.Printf("Task %d resuming chunked transcode, %d/%d segments done", task.ID, finished, len(segments))
+	}
+
+	// 按分段时长加权计算整体进度，时长未知时按分段数量平均
+	weight := func(seg *models.TaskSegment) float64 {
+		return seg.Duration
+	}
+	var total float64
+	for _, seg := range segments {
+		total += seg.Duration
+	}
+	if total <= 0 {
+		weight = func(*models.TaskSegment) float64 { return 1 }
+		total = float64(len(segments))
+	}
+
+	var todo []*models.TaskSegment
+	var doneWeight float64
+	encoded := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		encPath := ffmpeg.EncodedSegmentPath(workDir, seg.Index)
+		encoded = append(encoded, encPath)
+
+		if seg.Done {
+			if _, err := os.Stat(encPath); err == nil {
+				doneWeight += weight(seg)
+				continue
+			}
+			// 记录为已完成但文件丢失，重新转码该分段
+			log.Printf("Task %d segment %d output missing, re-encoding", task.ID, seg.Index)
+		}
+		todo = append(todo, seg)
+	}
+
+	// 汇总所有分段的进度，作为任务的整体进度
+	var progressMu sync.Mutex
+	partial := make(map[int]float64)
+	finished := len(segments) - len(todo)
+	report := func(message string) {
+		sum := doneWeight
+		for _, w := range partial {
+			sum += w
+		}
+		callback(sum/total*99, fmt.Sprintf("segments %d/%d: %s", finished, len(segments), message))
+	}
+
+	encodeSegment := func(seg *models.TaskSegment) error {
+		segWeight := weight(seg)
+		segCallback := func(progress float64, message string) {
+			progressMu.Lock()
+			defer progressMu.Unlock()
+			partial[seg.Index] = segWeight * progress / 100
+			report(message)
+		}
+
+		srcPath := ffmpeg.SourceSegmentPath(workDir, seg.Index)
+		encPath := ffmpeg.EncodedSegmentPath(workDir, seg.Index)
+		err := tq.runCmd(rt, func() (*exec.Cmd, error) {
+			return rt.ff.Transcode(srcPath, encPath, task.Params, segCallback)
+		}, func(pid int) {
+			tq.db.SetTaskSegmentPID(task.ID, seg.Index, pid)
+		})
+		tq.db.SetTaskSegmentPID(task.ID, seg.Index, 0)
+		if err != nil {
+			return err
+		}
+		if err := tq.db.SetTaskSegmentDone(task.ID, seg.Index, true); err != nil {
+			return err
+		}
+
+		progressMu.Lock()
+		delete(partial, seg.Index)
+		doneWeight += segWeight
+		finished++
+		report(fmt.Sprintf("segment %d done", seg.Index+1))
+		progressMu.Unlock()
+		return nil
+	}
+
+	if err := tq.encodeSegments(rt, todo, params.Parallel, encodeSegment); err != nil {
+		return err
+	}
+
+	// 合并所有分段
+	concatCallback := func(progress float64, message string) {
+		callback(99+progress/100, "concat: "+message)
+	}
+	err = tq.runCmd(rt, func() (*exec.Cmd, error) {
+		return rt.ff.ConcatSegments(task.InputPath, encoded, workDir, outputPath, concatCallback)
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	tq.removeWorkDir(task.ID)
+	return nil
+}
+
+// encodeSegments 转码分段。parallel 不大于 1 时依次执行；否则启动多个 goroutine，
+// 每个分段转码前从 chunkSlots 获取名额。任一分段失败时终止其余进程并返回第一个错误
+func (tq *TaskQueue) encodeSegments(rt *runningTask, segments []*models.TaskSegment, parallel int, encode func(seg *models.TaskSegment) error) error {
+	if parallel <= 1 {
+		for _, seg := range segments {
+			if err := encode(seg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if parallel > cap(tq.chunkSlots) {
+		parallel = cap(tq.chunkSlots)
+	}
+	log.Printf("Task %d encoding %d segments, %d in parallel", rt.task.ID, len(segments), parallel)
+
+	jobs := make(chan *models.TaskSegment)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seg := range jobs {
+				tq.chunkSlots <- struct{}{}
+				err := encode(seg)
+				<-tq.chunkSlots
+
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						// 终止其他分段的进程，剩余分段不再启动
+						tq.cancelMu.Lock()
+						rt.failed = true
+						rt.signalAll(killProcess)
+						tq.cancelMu.Unlock()
+					})
+				}
+			}
+		}()
+	}
+
+	for _, seg := range segments {
+		jobs <- seg
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+// splitSegments 按关键帧把输入切分到工作目录，并把分段记录到数据库
+func (tq *TaskQueue) splitSegments(rt *runningTask, workDir string, segmentSeconds int, callback ffmpeg.ProgressCallback) ([]*models.TaskSegment, error) {
+	task := rt.task
+
+	// 清理上次未完成的切分结果
+	if err := os.RemoveAll(workDir); err != nil {
+		return nil, err
+	}
+
+	splitCallback := func(progress float64, message string) {
+		callback(0, "split: "+message)
+	}
+	err := tq.runCmd(rt, func() (*exec.Cmd, error) {
+		return rt.ff.SplitSegments(task.InputPath, workDir, segmentSeconds, splitCallback)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ffmpeg.ListSourceSegments(workDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("split produced no segments")
+	}
+
+	segments := make([]*models.TaskSegment, 0, len(files))
+	for i, file := range files {
+		duration, err := tq.ffmpeg.GetVideoDuration(file)
+		if err != nil {
+			duration = 0
+		}
+		segments = append(segments, &models.TaskSegment{TaskID: task.ID, Index: i, Duration: duration})
+	}
+
+	if err := tq.db.CreateTaskSegments(task.ID, segments); err != nil {
+		return nil, err
+	}
+	log.Printf("Task %d split into %d segments", task.ID, len(segments))
+	return segments, nil
+}
+
+// killSegmentOrphans 终止上次异常退出时仍在转码分段的 FFmpeg 进程
+func (tq *TaskQueue) killSegmentOrphans(taskID int64) {
+	segments, err := tq.db.GetTaskSegments(taskID)
+	if err != nil {
+		log.Printf("Failed to load segments of task %d: %v", taskID, err)
+		return
+	}
+	for _, seg := range segments {
+		if seg.PID <= 0 {
+			continue
+		}
+		if killed, err := killOrphan(seg.PID, tq.ffmpeg.BinaryPath); err != nil {
+			log.Printf("Failed to kill orphaned ffmpeg (PID: %d) of task %d segment %d: %v", seg.PID, taskID, seg.Index, err)
+		} else if killed {
+			log.Printf("Killed orphaned ffmpeg (PID: %d) of task %d segment %d", seg.PID, taskID, seg.Index)
+		}
+		tq.db.SetTaskSegmentPID(taskID, seg.Index, 0)
+	}
+}
@@ -0,0 +1,201 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"videoforge/config"
+	"videoforge/database"
+	"videoforge/models"
+)
+
+// ConflictError 输出路径冲突且策略为 fail
+type ConflictError struct {
+	Path   string
+	TaskID int64 // 正在写入该路径的其他任务，0 表示文件已存在
+}
+
+func (e *ConflictError) Error() string {
+	if e.TaskID != 0 {
+		return fmt.Sprintf("output path conflict: %s is being written by task %d", e.Path, e.TaskID)
+	}
+	return fmt.Sprintf("output path conflict: %s already exists", e.Path)
+}
+
+// ConflictPolicy 校验输出冲突策略，为空时使用 ffmpeg.onConflict 配置，默认 rename
+func ConflictPolicy(requested string) (string, error) {
+	policy := requested
+	if policy == "" {
+		policy = config.GlobalConfig.FFmpeg.OnConflict
+	}
+	switch policy {
+	case "":
+		return models.OnConflictRename, nil
+	case models.OnConflictOverwrite, models.OnConflictSkip, models.OnConflictRename, models.OnConflictFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid onConflict: %s", policy)
+	}
+}
+
+// OutputKey 用于比较两个输出路径是否相同
+func OutputKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// outputForms 返回 path 在数据库中可能的几种写法：原样、整理后、绝对路径以及相对于工作目录的路径，
+// 它们的 OutputKey 都相同
+func outputForms(path string) []string {
+	forms := []string{path}
+	add := func(p string) {
+		for _, f := range forms {
+			if f == p {
+				return
+			}
+		}
+		forms = append(forms, p)
+	}
+
+	add(filepath.Clean(path))
+	if abs, err := filepath.Abs(path); err == nil {
+		add(abs)
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, abs); err == nil {
+				add(rel)
+			}
+		}
+	}
+	return forms
+}
+
+// ActiveOutputTask 返回输出路径与 path 相同的未结束任务，排除 exclude，没有时返回 nil。
+// 只按输出路径查询，不加载整个队列
+func ActiveOutputTask(db *database.DB, path string, exclude int64) (*models.Task, error) {
+	return db.GetActiveTaskByOutput(outputForms(path), exclude)
+}
+
+// OutputExists 输出路径上是否已有文件或目录
+func OutputExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// RenameOutput 在文件名后依次加 _1、_2 等后缀，返回第一个不存在且未被 taken 占用的路径
+func RenameOutput(path string, taken func(path string) bool) string {
+	dir := filepath.Dir(path)
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+
+	for i := 1; ; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s_%d%s", name, i, ext))
+		if !OutputExists(candidate) && (taken == nil || !taken(candidate)) {
+			return candidate
+		}
+	}
+}
+
+// runningOutputTask 返回已被领取、即将或正在写入相同输出路径的其他任务（本地或远程），没有则返回 0。
+// 调用方需持有 conflictMu，任务的输出路径只在持有 conflictMu 时修改
+func (tq *TaskQueue) runningOutputTask(path string, exclude int64) int64 {
+	key := OutputKey(path)
+
+	// 同一轮调度领取的任务可能还没有登记到 running
+	tq.mu.Lock()
+	for id, task := range tq.dispatched {
+		if id != exclude && OutputKey(task.OutputPath) == key {
+			tq.mu.Unlock()
+			return id
+		}
+	}
+	tq.mu.Unlock()
+
+	tq.cancelMu.Lock()
+	defer tq.cancelMu.Unlock()
+
+	for id, rt := range tq.running {
+		if id != exclude && OutputKey(rt.task.OutputPath) == key {
+			return id
+		}
+	}
+	for id, lease := range tq.leases {
+		if id != exclude && OutputKey(lease.task.OutputPath) == key {
+			return id
+		}
+	}
+	return 0
+}
+
+// resolveOutputConflict 任务开始执行前再次检查输出路径，按冲突策略处理。
+// 多个任务同时开始时依次检查，先检查的任务避开其他已领取的任务。
+// 返回 false 表示任务已被跳过或已记录为失败，不再执行
+func (tq *TaskQueue) resolveOutputConflict(task *models.Task) bool {
+	tq.conflictMu.Lock()
+	defer tq.conflictMu.Unlock()
+
+	policy, err := ConflictPolicy(task.OnConflict)
+	if err != nil {
+		log.Printf("Task %d: %v, using default", task.ID, err)
+		policy, _ = ConflictPolicy("")
+	}
+	if policy == models.OnConflictOverwrite {
+		return true
+	}
+
+	other := int64(0)
+	if !OutputExists(task.OutputPath) {
+		if other = tq.runningOutputTask(task.OutputPath, task.ID); other == 0 {
+			return true
+		}
+	}
+	conflict := &ConflictError{Path: task.OutputPath, TaskID: other}
+
+	switch policy {
+	case models.OnConflictSkip:
+		tq.skipTask(task, conflict.Error())
+		return false
+	case models.OnConflictFail:
+		tq.handleTaskError(task, conflict)
+		return false
+	}
+
+	// rename：避开已存在的文件以及其他未完成任务的输出
+	oldPath := task.OutputPath
+	newPath := RenameOutput(oldPath, func(path string) bool {
+		if tq.runningOutputTask(path, task.ID) != 0 {
+			return true
+		}
+		other, err := ActiveOutputTask(tq.db, path, task.ID)
+		if err != nil {
+			log.Printf("Failed to check output path %s: %v", path, err)
+		}
+		return other != nil
+	})
+	if err := tq.db.UpdateTaskOutputPath(task.ID, oldPath, newPath); err != nil {
+		tq.handleTaskError(task, err)
+		return false
+	}
+	task.OutputPath = newPath
+
+	log.Printf("Task %d output renamed to %s (%s)", task.ID, newPath, conflict.Error())
+	return true
+}
+
+// skipTask 输出已存在且策略为 skip：不执行任务，下游任务使用已有的输出继续
+func (tq *TaskQueue) skipTask(task *models.Task, reason string) {
+	log.Printf("Task %d skipped: %s", task.ID, reason)
+	tq.db.UpdateTaskStatus(task.ID, models.TaskStatusSkipped, 0, reason)
+	tq.recordEvent(task, models.TaskEventSkipped, reason)
+	tq.notifyProgress(models.ProgressUpdate{
+		TaskID:   task.ID,
+		Status:   string(models.TaskStatusSkipped),
+		FileName: filepath.Base(task.InputPath),
+		Message:  reason,
+	})
+	tq.wake()
+}
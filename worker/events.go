@@ -0,0 +1,24 @@
+package worker
+
+import (
+	"log"
+	"os"
+	"time"
+	"videoforge/models"
+)
+
+// hostname 本机主机名，记录在 started 事件中
+var hostname, _ = os.Hostname()
+
+// recordEvent 追加一条任务事件，失败时只记录日志，不影响任务执行
+func (tq *TaskQueue) recordEvent(task *models.Task, event, message string) {
+	tq.saveEvent(&models.TaskEvent{TaskID: task.ID, Event: event, Attempt: task.Attempts, Message: message})
+}
+
+// saveEvent 补齐时间后写入事件
+func (tq *TaskQueue) saveEvent(event *models.TaskEvent) {
+	event.CreatedAt = time.Now()
+	if err := tq.db.CreateTaskEvent(event); err != nil {
+		log.Printf("Failed to record %s event of task %d: %v", event.Event, event.TaskID, err)
+	}
+}
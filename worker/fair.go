@@ -0,0 +1,337 @@
+package worker
+
+import (
+	"container/heap"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+	"videoforge/config"
+	"videoforge/database"
+	"videoforge/models"
+)
+
+// fairnessMode 返回配置的公平调度方式，未配置或无法识别时返回空，按提交顺序调度
+func fairnessMode() string {
+	switch mode := config.GlobalConfig.Worker.Fairness.Mode; mode {
+	case models.FairByOwner, models.FairByBatch:
+		return mode
+	default:
+		return ""
+	}
+}
+
+// ValidateFairness 检查公平调度配置，启动时调用
+func ValidateFairness() {
+	if mode := config.GlobalConfig.Worker.Fairness.Mode; mode != "" && fairnessMode() == "" {
+		log.Printf("Unknown worker.fairness.mode %q, tasks are scheduled in submission order", mode)
+	}
+}
+
+// fairGroup 任务所在的轮转分组，与 database.fairGroupExpr 一致
+func fairGroup(mode, owner, batchID string, id int64) string {
+	if mode == models.FairByBatch {
+		if batchID == "" {
+			return "task:" + strconv.FormatInt(id, 10)
+		}
+		return "batch:" + batchID
+	}
+	return owner
+}
+
+// fairWeight 任务所在分组的权重：任务指定的权重优先，其次是提交者的权重，默认 1
+func fairWeight(owner string, weight int) float64 {
+	if weight > 0 {
+		return float64(weight)
+	}
+	if w := config.GlobalConfig.Worker.Fairness.Weights[owner]; w > 0 {
+		return float64(w)
+	}
+	return 1
+}
+
+// ownerLimit 提交者同时运行的任务数上限，0 表示不限制。未注明提交者的任务不受限制
+func ownerLimit(owner string) int {
+	if owner == "" {
+		return 0
+	}
+	if limit, ok := config.GlobalConfig.Worker.Fairness.OwnerLimits[owner]; ok {
+		return limit
+	}
+	return config.GlobalConfig.Worker.Fairness.MaxRunningPerOwner
+}
+
+// remoteRunningByOwner 统计远程 worker 正在执行的任务数，按提交者分组
+func (tq *TaskQueue) remoteRunningByOwner() map[string]int {
+	tq.cancelMu.Lock()
+	defer tq.cancelMu.Unlock()
+
+	counts := make(map[string]int)
+	for _, lease := range tq.leases {
+		if lease.task.Owner != "" {
+			counts[lease.task.Owner]++
+		}
+	}
+	return counts
+}
+
+// blockedOwnersLocked 返回运行中任务数（本机和远程合计）已达上限的提交者。调用方需持有 mu
+func (tq *TaskQueue) blockedOwnersLocked(remote map[string]int) []string {
+	var blocked []string
+	seen := make(map[string]bool)
+	for _, counts := range []map[string]int{tq.runningByOwner, remote} {
+		for owner := range counts {
+			if seen[owner] {
+				continue
+			}
+			seen[owner] = true
+			if limit := ownerLimit(owner); limit > 0 && tq.runningByOwner[owner]+remote[owner] >= limit {
+				blocked = append(blocked, owner)
+			}
+		}
+	}
+	return blocked
+}
+
+// 公平调度采用步进调度（stride scheduling）：每个分组有一个虚拟时间 pass，
+// 同优先级的任务中选择 pass 最小的分组，执行一个任务后 pass 增加 1/权重。
+// 新加入或重新出现的分组从当前最小的 pass 开始，不会因为之前空闲而积累额度
+
+// nextFair 按公平顺序查找第一个现在可以执行、且 accept 返回 true 的任务，没有时返回 nil。
+// 每次读取各分组排在最前的任务，被拒绝的任务排除后再读取下一批，直到没有剩余的任务。
+// 能在查询中表达的条件应放在 filter 中，accept 只用于少量例外。调用方需持有 mu
+func (tq *TaskQueue) nextFair(now time.Time, mode string, filter database.ReadyFilter, accept func(*models.Task) bool) (*models.Task, error) {
+	for {
+		heads, err := tq.db.GetReadyHeads(now, mode, filter)
+		if err != nil || len(heads) == 0 {
+			return nil, err
+		}
+
+		groups := make(map[string]bool, len(heads))
+		for _, t := range heads {
+			groups[fairGroup(mode, t.Owner, t.BatchID, t.ID)] = true
+		}
+		tq.syncFairLocked(groups)
+
+		sort.SliceStable(heads, func(i, j int) bool {
+			a, b := heads[i], heads[j]
+			if a.Priority != b.Priority {
+				return a.Priority > b.Priority
+			}
+			pa := tq.fairPass[fairGroup(mode, a.Owner, a.BatchID, a.ID)]
+			pb := tq.fairPass[fairGroup(mode, b.Owner, b.BatchID, b.ID)]
+			if pa != pb {
+				return pa < pb
+			}
+			return a.ID < b.ID
+		})
+		for _, t := range heads {
+			if accept == nil || accept(t) {
+				return t, nil
+			}
+			filter.ExcludeIDs = append(filter.ExcludeIDs, t.ID)
+		}
+	}
+}
+
+// syncFairLocked 删除已没有可执行任务的分组，新分组从当前最小的 pass 开始。调用方需持有 mu
+func (tq *TaskQueue) syncFairLocked(groups map[string]bool) {
+	for g := range tq.fairPass {
+		if !groups[g] {
+			delete(tq.fairPass, g)
+		}
+	}
+	base := minPass(tq.fairPass)
+	for g := range groups {
+		if _, ok := tq.fairPass[g]; !ok {
+			tq.fairPass[g] = base
+		}
+	}
+}
+
+// chargeFairLocked 任务被领取后增加所在分组的 pass。调用方需持有 mu
+func (tq *TaskQueue) chargeFairLocked(task *models.Task) {
+	mode := fairnessMode()
+	if mode == "" {
+		return
+	}
+	g := fairGroup(mode, task.Owner, task.BatchID, task.ID)
+	tq.fairPass[g] += 1 / fairWeight(task.Owner, task.Weight)
+}
+
+// minPass 返回最小的 pass，没有分组时返回 0
+func minPass(pass map[string]float64) float64 {
+	first := true
+	var min float64
+	for _, p := range pass {
+		if first || p < min {
+			min = p
+			first = false
+		}
+	}
+	return min
+}
+
+// QueuePosition 等待中任务的排队位置
+type QueuePosition struct {
+	TaskID        int64  `json:"taskId"`
+	Owner         string `json:"owner,omitempty"`
+	BatchID       string `json:"batchId,omitempty"`
+	Position      int    `json:"position"`                // 从 1 开始，1 表示下一个执行
+	EstimatedWait *int64 `json:"estimatedWait,omitempty"` // 预计等待的秒数，还没有同类任务的执行耗时时为空
+}
+
+// QueuePositions 按公平调度的顺序估算等待中任务的排队位置和等待时间，owner 不为空时只返回该提交者的任务。
+// 已暂停的任务不参与排队；尚未到开始时间、依赖未完成或受并发上限限制的任务按可以执行计算，结果仅供参考
+func (tq *TaskQueue) QueuePositions(owner string) ([]QueuePosition, error) {
+	entries, err := tq.db.GetQueueOrder()
+	if err != nil {
+		return nil, err
+	}
+	queued := entries[:0]
+	for _, e := range entries {
+		if e.Status != models.TaskStatusPaused {
+			queued = append(queued, e)
+		}
+	}
+
+	tq.mu.Lock()
+	mode := fairnessMode()
+	pass := make(map[string]float64, len(tq.fairPass))
+	for g, p := range tq.fairPass {
+		pass[g] = p
+	}
+	runtimes := make(map[models.TaskType]time.Duration, len(tq.runtimes))
+	for t, d := range tq.runtimes {
+		runtimes[t] = d
+	}
+	workers := tq.maxWorkers
+	tq.mu.Unlock()
+
+	if mode != "" {
+		queued = fairOrder(queued, mode, pass)
+	}
+
+	// 没有执行记录的任务类型使用所有类型的平均耗时
+	var fallback time.Duration
+	for _, d := range runtimes {
+		fallback += d
+	}
+	if len(runtimes) > 0 {
+		fallback /= time.Duration(len(runtimes))
+	}
+
+	var positions []QueuePosition
+	var ahead time.Duration
+	for i, e := range queued {
+		if owner == "" || e.Owner == owner {
+			p := QueuePosition{TaskID: e.ID, Owner: e.Owner, BatchID: e.BatchID, Position: i + 1}
+			if fallback > 0 {
+				wait := int64((ahead / time.Duration(workers)).Seconds())
+				p.EstimatedWait = &wait
+			}
+			positions = append(positions, p)
+		}
+		if d, ok := runtimes[e.Type]; ok {
+			ahead += d
+		} else {
+			ahead += fallback
+		}
+	}
+	return positions, nil
+}
+
+// fairOrder 模拟调度循环，按优先级从高到低、同优先级按分组轮转的顺序排列等待中的任务。
+// entries 需已按优先级从高到低、同优先级按 ID 排序
+func fairOrder(entries []database.QueueEntry, mode string, pass map[string]float64) []database.QueueEntry {
+	ordered := make([]database.QueueEntry, 0, len(entries))
+	for start := 0; start < len(entries); {
+		end := start
+		for end < len(entries) && entries[end].Priority == entries[start].Priority {
+			end++
+		}
+
+		// 同优先级的任务按分组排队，每组内保持 ID 顺序
+		queues := make(map[string][]database.QueueEntry)
+		var groups []string
+		for _, e := range entries[start:end] {
+			g := fairGroup(mode, e.Owner, e.BatchID, e.ID)
+			if _, ok := queues[g]; !ok {
+				groups = append(groups, g)
+			}
+			queues[g] = append(queues[g], e)
+		}
+
+		active := make(map[string]float64)
+		for _, g := range groups {
+			if p, ok := pass[g]; ok {
+				active[g] = p
+			}
+		}
+		base := minPass(active)
+
+		h := &passHeap{}
+		for _, g := range groups {
+			p, ok := pass[g]
+			if !ok {
+				p = base
+			}
+			heap.Push(h, passItem{group: g, pass: p, head: queues[g][0].ID})
+		}
+		for h.Len() > 0 {
+			item := heap.Pop(h).(passItem)
+			e := queues[item.group][0]
+			queues[item.group] = queues[item.group][1:]
+			ordered = append(ordered, e)
+
+			item.pass += 1 / fairWeight(e.Owner, e.Weight)
+			pass[item.group] = item.pass
+			if q := queues[item.group]; len(q) > 0 {
+				item.head = q[0].ID
+				heap.Push(h, item)
+			}
+		}
+		start = end
+	}
+	return ordered
+}
+
+// passItem 模拟排队时的分组
+type passItem struct {
+	group string
+	pass  float64
+	head  int64 // 组内排在最前的任务 ID，pass 相同时 ID 小的先执行
+}
+
+// passHeap 按 pass 排列的最小堆
+type passHeap []passItem
+
+func (h passHeap) Len() int { return len(h) }
+func (h passHeap) Less(i, j int) bool {
+	if h[i].pass != h[j].pass {
+		return h[i].pass < h[j].pass
+	}
+	return h[i].head < h[j].head
+}
+func (h passHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *passHeap) Push(x interface{}) { *h = append(*h, x.(passItem)) }
+func (h *passHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// runtimeSmoothing 平均执行耗时的平滑系数，越大越偏向最近的任务
+const runtimeSmoothing = 0.2
+
+// recordRuntime 记录任务类型的执行耗时，用于估算排队等待时间
+func (tq *TaskQueue) recordRuntime(taskType models.TaskType, d time.Duration) {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	if avg, ok := tq.runtimes[taskType]; ok {
+		d = time.Duration(float64(avg)*(1-runtimeSmoothing) + float64(d)*runtimeSmoothing)
+	}
+	tq.runtimes[taskType] = d
+}
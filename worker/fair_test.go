@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+	"videoforge/config"
+	"videoforge/database"
+	"videoforge/models"
+)
+
+func TestFairOrder(t *testing.T) {
+	weights := config.GlobalConfig.Worker.Fairness.Weights
+	config.GlobalConfig.Worker.Fairness.Weights = map[string]int{"a": 2}
+	defer func() { config.GlobalConfig.Worker.Fairness.Weights = weights }()
+
+	byOwner := func(id int64, priority int, owner string) database.QueueEntry {
+		return database.QueueEntry{ID: id, Priority: priority, Owner: owner}
+	}
+	byBatch := func(id int64, batchID string) database.QueueEntry {
+		return database.QueueEntry{ID: id, BatchID: batchID}
+	}
+	owners := []database.QueueEntry{
+		byOwner(1, 0, "a"), byOwner(2, 0, "a"), byOwner(3, 0, "a"), byOwner(4, 0, "a"),
+		byOwner(5, 0, "b"), byOwner(6, 0, "b"),
+		byOwner(7, 0, "c"),
+	}
+
+	tests := []struct {
+		name    string
+		mode    string
+		entries []database.QueueEntry
+		pass    map[string]float64
+		want    []int64
+	}{
+		{
+			// a 的权重为 2，每执行两个任务其他分组执行一个；pass 相同时 ID 小的先执行
+			name:    "weighted owners",
+			mode:    models.FairByOwner,
+			entries: owners,
+			want:    []int64{1, 5, 7, 2, 3, 6, 4},
+		},
+		{
+			// 已有的 pass 保留，新分组从当前最小的 pass 开始
+			name:    "existing pass",
+			mode:    models.FairByOwner,
+			entries: owners,
+			pass:    map[string]float64{"a": 1, "b": 0},
+			want:    []int64{5, 7, 1, 6, 2, 3, 4},
+		},
+		{
+			// 优先级高的任务先执行，不参与低优先级的轮转
+			name:    "priority first",
+			mode:    models.FairByOwner,
+			entries: append([]database.QueueEntry{byOwner(8, 1, "c"), byOwner(9, 1, "c")}, owners...),
+			want:    []int64{8, 9, 1, 5, 7, 2, 3, 6, 4},
+		},
+		{
+			// 没有批次的任务各自为一组
+			name:    "batches",
+			mode:    models.FairByBatch,
+			entries: []database.QueueEntry{byBatch(1, "x"), byBatch(2, "x"), byBatch(3, "x"), byBatch(4, ""), byBatch(5, "")},
+			want:    []int64{1, 4, 5, 2, 3},
+		},
+	}
+	for _, tt := range tests {
+		pass := tt.pass
+		if pass == nil {
+			pass = make(map[string]float64)
+		}
+		var got []int64
+		for _, e := range fairOrder(tt.entries, tt.mode, pass) {
+			got = append(got, e.ID)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: fairOrder = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"videoforge/config"
+	"videoforge/ffmpeg"
+	"videoforge/models"
+)
+
+// TaskLogPath 任务的 FFmpeg 日志文件，轮转后的旧日志为 .1、.2……
+func TaskLogPath(taskID int64) string {
+	dir := config.GlobalConfig.FFmpeg.LogDir
+	if dir == "" {
+		dir = "./logs"
+	}
+	return filepath.Join(dir, fmt.Sprintf("task-%d.log", taskID))
+}
+
+// TaskLogBackups 轮转后保留的旧日志个数
+func TaskLogBackups() int {
+	if n := config.GlobalConfig.FFmpeg.LogBackups; n > 0 {
+		return n
+	}
+	return 2
+}
+
+// taskLogMaxSize 单个日志文件的最大字节数
+func taskLogMaxSize() int64 {
+	mb := config.GlobalConfig.FFmpeg.LogMaxSizeMB
+	if mb <= 0 {
+		mb = 10
+	}
+	return int64(mb) << 20
+}
+
+// openTaskLog 打开任务日志并记录本次执行的开始，失败时只记录日志、返回 nil，任务照常执行
+func openTaskLog(task *models.Task, host string) *ffmpeg.TaskLog {
+	l, err := ffmpeg.OpenTaskLog(TaskLogPath(task.ID), taskLogMaxSize(), TaskLogBackups())
+	if err != nil {
+		log.Printf("Failed to open ffmpeg log of task %d: %v", task.ID, err)
+		return nil
+	}
+	l.Printf("attempt %d of task %d (%s) started on %s", task.Attempts, task.ID, task.Type, host)
+	return l
+}
+
+// withStderr 把 FFmpeg 非零退出的错误补充为日志中最后几行错误输出
+func withStderr(err error, l *ffmpeg.TaskLog) error {
+	var exitErr *exec.ExitError
+	if l == nil || !errors.As(err, &exitErr) {
+		return err
+	}
+	return &ffmpeg.ExitError{Err: err, Stderr: l.ErrorSummary()}
+}
+
+// removeTaskLogs 删除任务的 FFmpeg 日志
+func removeTaskLogs(taskID int64) {
+	path := TaskLogPath(taskID)
+	for _, name := range ffmpeg.LogFiles(path, TaskLogBackups()) {
+		if err := os.Remove(name); err != nil {
+			log.Printf("Failed to remove ffmpeg log %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"videoforge/config"
+	"videoforge/models"
+)
+
+// 钩子输出最多保存的字节数
+const maxHookOutput = 64 * 1024
+
+// defaultHookTimeout 钩子和 hooks.timeout 都未设置超时时间时使用
+const defaultHookTimeout = 60 * time.Second
+
+// hookWaitDelay 钩子命令被终止后等待其输出关闭的最长时间，后台子进程仍持有输出时不再等待
+const hookWaitDelay = 2 * time.Second
+
+// 钩子的来源
+const (
+	hookScopeTask   = "task"
+	hookScopeGlobal = "global"
+)
+
+// hookPayload 通过 stdin 或 HTTP 请求体传给钩子的 JSON
+type hookPayload struct {
+	Event string       `json:"event"`
+	Error string       `json:"error,omitempty"`
+	Task  *models.Task `json:"task"`
+}
+
+// ValidateHooks 检查钩子定义。fromRequest 为 true 表示钩子随 API 请求提交，
+// 此时只有配置 hooks.allowRequestCommands 后才允许执行本地命令
+func ValidateHooks(hooks []models.Hook, fromRequest bool) error {
+	for i, hook := range hooks {
+		name := hook.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		if (hook.Command == "") == (hook.URL == "") {
+			return fmt.Errorf("hook %s: exactly one of command and url is required", name)
+		}
+		for _, event := range hook.On {
+			if event != models.HookEventFinished && event != models.HookEventFailed {
+				return fmt.Errorf("hook %s: unknown event %q", name, event)
+			}
+		}
+		if hook.Timeout < 0 {
+			return fmt.Errorf("hook %s: timeout must not be negative", name)
+		}
+		if hook.Command != "" && fromRequest && !config.GlobalConfig.Hooks.AllowRequestCommands {
+			return fmt.Errorf("hook %s: command hooks are disabled for API requests", name)
+		}
+		if hook.URL != "" {
+			u, err := url.Parse(hook.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("hook %s: invalid url %q", name, hook.URL)
+			}
+		}
+	}
+	return nil
+}
+
+// hookTriggered 钩子是否在 event 时执行
+func hookTriggered(hook models.Hook, event string) bool {
+	if len(hook.On) == 0 {
+		return true
+	}
+	for _, on := range hook.On {
+		if on == event {
+			return true
+		}
+	}
+	return false
+}
+
+// runHooks 在后台依次执行任务自身的钩子和全局钩子，并记录每个钩子的输出和退出状态。
+// 钩子失败不影响任务状态
+func (tq *TaskQueue) runHooks(task *models.Task, event string, taskErr error) {
+	type scopedHook struct {
+		hook  models.Hook
+		scope string
+	}
+	var hooks []scopedHook
+	for _, hook := range task.Hooks {
+		if hookTriggered(hook, event) {
+			hooks = append(hooks, scopedHook{hook, hookScopeTask})
+		}
+	}
+	for _, hook := range config.GlobalConfig.Hooks.Global {
+		if hookTriggered(hook, event) {
+			hooks = append(hooks, scopedHook{hook, hookScopeGlobal})
+		}
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	go func() {
+		// 以数据库中的最新状态作为钩子的输入
+		current := task
+		if t, err := tq.db.GetTask(task.ID); err == nil {
+			current = t
+		}
+		payload := hookPayload{Event: event, Task: current}
+		if taskErr != nil {
+			payload.Error = taskErr.Error()
+		}
+
+		for _, h := range hooks {
+			run := runHook(h.hook, payload)
+			run.Scope = h.scope
+			if err := tq.db.CreateHookRun(run); err != nil {
+				log.Printf("Failed to save hook result of task %d: %v", task.ID, err)
+			}
+			if run.Error != "" {
+				log.Printf("Task %d %s hook %s failed: %s", task.ID, event, run.Name, run.Error)
+			} else {
+				log.Printf("Task %d %s hook %s finished in %dms", task.ID, event, run.Name, run.DurationMs)
+			}
+		}
+	}()
+}
+
+// runHook 执行单个钩子并返回执行结果
+func runHook(hook models.Hook, payload hookPayload) *models.HookRun {
+	run := &models.HookRun{
+		TaskID:    payload.Task.ID,
+		Event:     payload.Event,
+		Name:      hook.Name,
+		Target:    hook.URL,
+		ExitCode:  -1,
+		StartedAt: time.Now(),
+	}
+	if hook.Command != "" {
+		run.Target = hook.Command
+	}
+	if run.Name == "" {
+		run.Name = run.Target
+	}
+
+	timeout := time.Duration(hook.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = time.Duration(config.GlobalConfig.Hooks.Timeout) * time.Second
+	}
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	body, err := json.Marshal(payload)
+	if err == nil {
+		if hook.Command != "" {
+			err = runCommandHook(ctx, hook, payload, body, run)
+		} else {
+			err = runHTTPHook(ctx, hook, body, run)
+		}
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %v", timeout)
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	run.DurationMs = time.Since(run.StartedAt).Milliseconds()
+	return run
+}
+
+// runCommandHook 执行本地命令，任务字段通过环境变量传入，payload 写入 stdin。
+// 命令运行在独立的进程组中，超时时连同其启动的子进程一起终止
+func runCommandHook(ctx context.Context, hook models.Hook, payload hookPayload, body []byte, run *models.HookRun) error {
+	task := payload.Task
+	cmd := exec.CommandContext(ctx, hook.Command, hook.Args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error { return killProcess(cmd.Process) }
+	cmd.WaitDelay = hookWaitDelay
+	cmd.Env = append(os.Environ(),
+		"VF_EVENT="+payload.Event,
+		"VF_TASK_ID="+strconv.FormatInt(task.ID, 10),
+		"VF_TASK_TYPE="+string(task.Type),
+		"VF_TASK_STATUS="+string(task.Status),
+		"VF_INPUT_PATH="+task.InputPath,
+		"VF_OUTPUT_PATH="+task.OutputPath,
+		"VF_ATTEMPTS="+strconv.Itoa(task.Attempts),
+		"VF_ERROR="+payload.Error,
+		"VF_ERROR_CODE="+task.ErrorCode,
+	)
+	cmd.Stdin = bytes.NewReader(body)
+	output := &limitedBuffer{limit: maxHookOutput}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	run.Output = output.String()
+	if cmd.ProcessState != nil {
+		run.ExitCode = cmd.ProcessState.ExitCode()
+	}
+	return err
+}
+
+// runHTTPHook 发送 HTTP 请求，请求体为 payload，非 2xx 响应视为失败
+func runHTTPHook(ctx context.Context, hook models.Hook, body []byte, run *models.HookRun) error {
+	method := strings.ToUpper(hook.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHookOutput))
+	run.Output = string(data)
+	run.ExitCode = resp.StatusCode
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// limitedBuffer 只保留前 limit 字节的输出，超出部分丢弃但不报错，避免阻塞子进程
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.buf.Write(p[:remaining])
+			b.truncated = true
+		} else {
+			b.buf.Write(p)
+		}
+	} else if len(p) > 0 {
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
@@ -0,0 +1,181 @@
+package worker
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"time"
+	"videoforge/models"
+)
+
+// ErrTaskNotActive 任务既不在等待队列中也没有在运行
+var ErrTaskNotActive = errors.New("task is not queued or running")
+
+// settingQueuePaused 队列全局暂停状态在 settings 表中的键
+const settingQueuePaused = "queue_paused"
+
+// QueueState 队列整体状态
+type QueueState struct {
+	Paused     bool `json:"paused"`
+	Running    int  `json:"running"`
+	Remote     int  `json:"remote"` // 远程 worker 正在执行的任务数
+	Waiting    int  `json:"waiting"`
+	MaxWorkers int  `json:"maxWorkers"`
+}
+
+// PauseTask 暂停任务：运行中的任务挂起 FFmpeg 进程（SIGSTOP），等待中的任务暂不调度
+func (tq *TaskQueue) PauseTask(id int64) error {
+	return tq.setTaskPaused(id, true)
+}
+
+// ResumeTask 恢复已暂停的任务：运行中的进程继续执行（SIGCONT），等待中的任务重新参与调度
+func (tq *TaskQueue) ResumeTask(id int64) error {
+	return tq.setTaskPaused(id, false)
+}
+
+func (tq *TaskQueue) setTaskPaused(id int64, paused bool) error {
+	status := models.TaskStatusPending
+	message := "Task resumed"
+	event := models.TaskEventResumed
+	if paused {
+		status = models.TaskStatusPaused
+		message = "Task paused"
+		event = models.TaskEventPaused
+	}
+
+	// 运行中的任务：挂起或恢复进程
+	tq.cancelMu.Lock()
+	if rt, ok := tq.running[id]; ok {
+		defer tq.cancelMu.Unlock()
+		if rt.paused == paused {
+			return nil
+		}
+
+		// 分段转码在两个进程之间可能没有进程可挂起，暂停状态会作用于之后启动的进程
+		var err error
+		if paused {
+			err = rt.signalAll(suspendProcess)
+		} else {
+			err = rt.signalAll(resumeProcess)
+			status = models.TaskStatusRunning
+		}
+		if err != nil {
+			return err
+		}
+
+		// 暂停期间不计入运行时间和卡死检测
+		if paused {
+			rt.pausedAt = time.Now()
+		} else {
+			pausedFor := time.Since(rt.pausedAt)
+			rt.startedAt = rt.startedAt.Add(pausedFor)
+			rt.lastActivity = rt.lastActivity.Add(pausedFor)
+		}
+
+		rt.paused = paused
+		tq.db.SetTaskStatus(id, status)
+		tq.recordEvent(rt.task, event, "")
+		log.Printf("%s: task %d", message, id)
+		tq.notifyProgress(models.ProgressUpdate{
+			TaskID:   id,
+			Status:   string(status),
+			FileName: filepath.Base(rt.task.InputPath),
+			Message:  message,
+		})
+		return nil
+	}
+	_, remote := tq.leases[id]
+	tq.cancelMu.Unlock()
+	if remote {
+		return ErrTaskRemote
+	}
+
+	// 等待中的任务：只修改状态，已暂停的任务不会被领取
+	from := []models.TaskStatus{models.TaskStatusPaused}
+	if paused {
+		from = []models.TaskStatus{models.TaskStatusPending, models.TaskStatusWaitingRes}
+	}
+	changed, err := tq.db.SetQueuedTaskStatus(id, from, status)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		// 已处于目标状态时不报错
+		if queued, err := tq.db.IsQueued(id); err != nil || !queued {
+			return ErrTaskNotActive
+		}
+		return nil
+	}
+
+	task, err := tq.db.GetTask(id)
+	if err != nil {
+		return err
+	}
+	tq.recordEvent(task, event, "")
+	tq.notifyProgress(models.ProgressUpdate{
+		TaskID:   id,
+		Status:   string(status),
+		FileName: filepath.Base(task.InputPath),
+		Message:  message,
+	})
+	if !paused {
+		tq.wake()
+	}
+	return nil
+}
+
+// PauseQueue 全局暂停队列：正在运行的任务继续执行，但不再启动新任务
+func (tq *TaskQueue) PauseQueue() error {
+	return tq.setQueuePaused(true)
+}
+
+// ResumeQueue 恢复队列调度
+func (tq *TaskQueue) ResumeQueue() error {
+	return tq.setQueuePaused(false)
+}
+
+func (tq *TaskQueue) setQueuePaused(paused bool) error {
+	value := "false"
+	if paused {
+		value = "true"
+	}
+	// 持久化，重启后保持暂停状态
+	if err := tq.db.SetSetting(settingQueuePaused, value); err != nil {
+		return err
+	}
+
+	tq.mu.Lock()
+	tq.queuePaused = paused
+	tq.mu.Unlock()
+
+	if paused {
+		log.Printf("Task queue paused")
+	} else {
+		log.Printf("Task queue resumed")
+		tq.wake()
+	}
+	return nil
+}
+
+// State 返回队列整体状态
+func (tq *TaskQueue) State() QueueState {
+	tq.cancelMu.Lock()
+	remote := len(tq.leases)
+	tq.cancelMu.Unlock()
+
+	waiting, err := tq.db.CountQueuedTasks()
+	if err != nil {
+		log.Printf("Failed to count queued tasks: %v", err)
+	}
+
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	return QueueState{
+		Paused:     tq.queuePaused,
+		Running:    tq.runningCount,
+		Remote:     remote,
+		Waiting:    waiting,
+		MaxWorkers: tq.maxWorkers,
+	}
+}
@@ -0,0 +1,65 @@
+//go:build !windows
+
+package worker
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup 让命令运行在独立的进程组中，便于连同子进程整组终止
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// suspendProcess 通过 SIGSTOP 挂起进程（FFmpeg 运行在独立进程组中，整组挂起）
+func suspendProcess(p *os.Process) error {
+	return signalGroup(p, syscall.SIGSTOP)
+}
+
+// resumeProcess 通过 SIGCONT 恢复被挂起的进程
+func resumeProcess(p *os.Process) error {
+	return signalGroup(p, syscall.SIGCONT)
+}
+
+// killProcess 终止 FFmpeg 所在的整个进程组
+func killProcess(p *os.Process) error {
+	return signalGroup(p, syscall.SIGKILL)
+}
+
+// signalGroup 向进程组发送信号，失败时退回到只向进程本身发送
+func signalGroup(p *os.Process, sig syscall.Signal) error {
+	if err := syscall.Kill(-p.Pid, sig); err == nil {
+		return nil
+	}
+	return p.Signal(sig)
+}
+
+// killOrphan 终止上次崩溃遗留的 FFmpeg 进程。
+// 只有通过 /proc 确认该 PID 仍然是 ffmpegPath 启动的进程时才会终止，避免误杀复用了 PID 的其他进程
+func killOrphan(pid int, ffmpegPath string) (bool, error) {
+	cmdline, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		// 进程已不存在，或系统没有 /proc
+		return false, nil
+	}
+
+	argv0 := cmdline
+	if i := bytes.IndexByte(cmdline, 0); i >= 0 {
+		argv0 = cmdline[:i]
+	}
+	if string(argv0) != ffmpegPath && filepath.Base(string(argv0)) != filepath.Base(ffmpegPath) {
+		return false, nil
+	}
+
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil {
+		if err := syscall.Kill(pid, syscall.SIGKILL); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package worker
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+var errSuspendUnsupported = errors.New("pausing a running task is not supported on Windows")
+
+// setProcessGroup Windows 下不设置进程组，终止时只能结束命令本身
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// suspendProcess Windows 下没有 SIGSTOP，暂不支持挂起运行中的进程
+func suspendProcess(p *os.Process) error {
+	return errSuspendUnsupported
+}
+
+// resumeProcess Windows 下没有 SIGCONT，暂不支持恢复
+func resumeProcess(p *os.Process) error {
+	return errSuspendUnsupported
+}
+
+// killProcess 终止 FFmpeg 进程
+func killProcess(p *os.Process) error {
+	return p.Kill()
+}
+
+// killOrphan Windows 下无法可靠地确认遗留进程，不做处理
+func killOrphan(pid int, ffmpegPath string) (bool, error) {
+	return false, nil
+}
@@ -1,40 +1,128 @@
 package worker
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
+	"videoforge/config"
 	"videoforge/database"
 	"videoforge/ffmpeg"
 	"videoforge/models"
+	"videoforge/processor"
+	"videoforge/schedule"
 
 	"os/exec"
 )
 
+// ErrTaskNotQueued 任务不在等待队列中（已开始、已结束或不存在）
+var ErrTaskNotQueued = errors.New("task is not waiting in queue")
+
+// runningTask 正在执行的任务及其 FFmpeg 进程
+type runningTask struct {
+	task        *models.Task
+	cmds        map[*exec.Cmd]struct{} // 当前运行的 FFmpeg 进程，并行分段转码时有多个
+	paused      bool
+	interrupted bool           // 服务停止时被终止
+	failed      bool           // 并行分段中有分段失败，不再启动新进程
+	started     bool           // 已记录 started 事件，由 cancelMu 保护
+	ff          *ffmpeg.FFmpeg // 把命令行和 stderr 写入任务日志
+
+	// 看门狗使用，由 cancelMu 保护
+	startedAt     time.Time
+	pausedAt      time.Time
+	lastActivity  time.Time
+	lastProgress  float64
+	lastMessage   string
+	timeoutReason string
+}
+
+// signalAll 对任务当前所有的 FFmpeg 进程执行 fn（挂起、恢复或 Kill），返回第一个错误。
+// 调用方需持有 cancelMu
+func (rt *runningTask) signalAll(fn func(p *os.Process) error) error {
+	var firstErr error
+	for cmd := range rt.cmds {
+		if err := fn(cmd.Process); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 type TaskQueue struct {
 	db         *database.DB
 	ffmpeg     *ffmpeg.FFmpeg
-	taskChan   chan *models.Task
 	isRunning  bool
 	mu         sync.Mutex
 	progressCb func(update models.ProgressUpdate)
 
-	currentTask *models.Task
-	currentCmd  *exec.Cmd
-	cancelMu    sync.Mutex
+	// 调度状态，由 mu 保护。等待中的任务保存在 tasks 表中，调度时按需读取
+	maxWorkers     int
+	typeLimits     map[models.TaskType]int
+	dispatched     map[int64]*models.Task // 已从队列领取、在本机执行的任务
+	runningCount   int
+	runningByType  map[models.TaskType]int
+	runningByOwner map[string]int                    // 本机运行中的任务数，按提交者分组
+	fairPass       map[string]float64                // 公平调度各分组的虚拟时间
+	runtimes       map[models.TaskType]time.Duration // 各任务类型的平均执行耗时
+	queuePaused    bool
+	stopping       bool
+	windows        []schedule.TimeWindow
+	wakeCh         chan struct{}
+
+	running       map[int64]*runningTask
+	cancelMu      sync.Mutex
 	canceledTasks map[int64]bool
+	leases        map[int64]*remoteLease // 远程 worker 领取的任务，由 cancelMu 保护
+
+	// 并行分段转码的进程预算，所有任务共享
+	chunkSlots chan struct{}
+
+	// 串行化回收站的移入、恢复和清理
+	trashMu sync.Mutex
+
+	// 串行化执行前的输出冲突检查和重命名
+	conflictMu sync.Mutex
 }
 
 func NewTaskQueue(db *database.DB, ffmpegPath string, threads int, progressCallback func(models.ProgressUpdate)) *TaskQueue {
+	maxWorkers := config.GlobalConfig.Worker.Concurrency
+	if maxWorkers <= 0 {
+		maxWorkers = 1
+	}
+
+	typeLimits := make(map[models.TaskType]int)
+	for taskType, limit := range config.GlobalConfig.Worker.TypeConcurrency {
+		if limit > 0 {
+			typeLimits[models.TaskType(taskType)] = limit
+		}
+	}
+
+	chunkWorkers := config.GlobalConfig.Worker.ChunkWorkers
+	if chunkWorkers <= 0 {
+		chunkWorkers = maxWorkers
+	}
+
 	return &TaskQueue{
-		db:            db,
-		ffmpeg:        ffmpeg.NewFFmpeg(ffmpegPath, threads),
-		taskChan:      make(chan *models.Task, 100),
-		isRunning:     false,
-		progressCb:    progressCallback,
-		canceledTasks: make(map[int64]bool),
+		db:             db,
+		ffmpeg:         ffmpeg.NewFFmpeg(ffmpegPath, threads),
+		isRunning:      false,
+		progressCb:     progressCallback,
+		maxWorkers:     maxWorkers,
+		typeLimits:     typeLimits,
+		dispatched:     make(map[int64]*models.Task),
+		runningByType:  make(map[models.TaskType]int),
+		runningByOwner: make(map[string]int),
+		fairPass:       make(map[string]float64),
+		runtimes:       make(map[models.TaskType]time.Duration),
+		wakeCh:         make(chan struct{}, 1),
+		running:        make(map[int64]*runningTask),
+		canceledTasks:  make(map[int64]bool),
+		leases:         make(map[int64]*remoteLease),
+		chunkSlots:     make(chan struct{}, chunkWorkers),
 	}
 }
 
@@ -46,6 +134,15 @@ func (tq *TaskQueue) Start() {
 		return
 	}
 	tq.isRunning = true
+	if paused, _ := tq.db.GetSetting(settingQueuePaused); paused == "true" {
+		tq.queuePaused = true
+		log.Printf("Task queue is paused, no new tasks will be started until resumed")
+	}
+	if windows, err := tq.loadTimeWindows(); err != nil {
+		log.Printf("Failed to load time windows: %v", err)
+	} else {
+		tq.windows = windows
+	}
 	tq.mu.Unlock()
 
 	// 恢复未完成的任务
@@ -57,39 +154,82 @@ func (tq *TaskQueue) Start() {
 
 	// 启动任务处理循环
 	go tq.processLoop()
+	go tq.watchLeases()
+	go tq.purgeTrashLoop()
 }
 
-// recoverPendingTasks 恢复未完成的任务
+// recoverPendingTasks 处理上次停止时仍在运行、被中断或状态不一致的任务，
+// 其余等待中的任务保存在 tasks 表中，由调度循环直接领取
 func (tq *TaskQueue) recoverPendingTasks() error {
-	tasks, err := tq.db.GetPendingTasks()
+	tasks, err := tq.db.GetRecoverableTasks()
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Recovering %d pending tasks", len(tasks))
+	log.Printf("Recovering %d unfinished tasks", len(tasks))
 
 	for _, task := range tasks {
-		// 重置 running 状态为 pending
-		if task.Status == models.TaskStatusRunning {
+		// 上次异常退出时仍在运行的 FFmpeg 进程会与重新执行的任务争抢输出文件，先终止
+		if task.PID > 0 {
+			if killed, err := killOrphan(task.PID, tq.ffmpeg.BinaryPath); err != nil {
+				log.Printf("Failed to kill orphaned ffmpeg (PID: %d) of task %d: %v", task.PID, task.ID, err)
+			} else if killed {
+				log.Printf("Killed orphaned ffmpeg (PID: %d) of task %d", task.PID, task.ID)
+			}
+			tq.db.SetTaskPID(task.ID, 0)
+			task.PID = 0
+		}
+		tq.killSegmentOrphans(task.ID)
+
+		// 已取消的任务不再执行，状态可能被取消时仍在运行的进程覆盖，这里恢复
+		if task.CanceledAt != nil {
+			if task.WorkerID != "" {
+				tq.db.SetTaskLease(task.ID, "", nil)
+			}
+			tq.db.SetTaskStatus(task.ID, models.TaskStatusCanceled)
+			continue
+		}
+
+		// 上次异常退出时留下的临时输出
+		if task.Status == models.TaskStatusRunning || task.Status == models.TaskStatusInterrupted {
+			ffmpeg.DiscardOutput(ffmpeg.PartialPath(task.OutputPath), task.OutputPath)
+		}
+
+		// 远程 worker 的租约随服务重启失效，worker 下次心跳时会停止执行
+		if task.WorkerID != "" {
+			tq.db.SetTaskLease(task.ID, "", nil)
+			task.WorkerID = ""
+			task.LeaseExpiresAt = nil
+		}
+
+		// 重置 running / interrupted 状态为 pending
+		if task.Status == models.TaskStatusRunning || task.Status == models.TaskStatusInterrupted {
+			tq.recordEvent(task, models.TaskEventRequeued, fmt.Sprintf("recovered %s task after restart", task.Status))
 			task.Status = models.TaskStatusPending
 			task.Progress = 0
 			tq.db.UpdateTaskStatus(task.ID, models.TaskStatusPending, 0, "")
 		}
-		tq.taskChan <- task
+		// 已暂停的任务保持暂停，进程已不存在，进度从 0 开始
+		if task.Status == models.TaskStatusPaused && task.Progress > 0 {
+			task.Progress = 0
+			tq.db.UpdateTaskStatus(task.ID, models.TaskStatusPaused, 0, "")
+		}
 	}
 
+	tq.wake()
 	return nil
 }
 
-// AddTask 添加任务到队列
+// AddTask 添加任务到队列：写入 tasks 表后唤醒调度循环，不会阻塞
 func (tq *TaskQueue) AddTask(task *models.Task) error {
 	task.Status = models.TaskStatusPending
 	if err := tq.db.CreateTask(task); err != nil {
 		return err
 	}
 
-	tq.taskChan <- task
+	tq.wake()
 
+	tq.recordEvent(task, models.TaskEventQueued, "")
 	tq.notifyProgress(models.ProgressUpdate{
 		TaskID:  task.ID,
 		Status:  string(models.TaskStatusPending),
@@ -99,10 +239,297 @@ func (tq *TaskQueue) AddTask(task *models.Task) error {
 	return nil
 }
 
-// processLoop 任务处理循环
+// processLoop 任务调度循环：有新任务、任务结束或状态变化时被唤醒，在有空闲槽位时分派给 worker
 func (tq *TaskQueue) processLoop() {
-	for task := range tq.taskChan {
-		tq.processTask(task)
+	for {
+		// 有尚未到开始时间或不在时间窗口内的任务时，到期后自动唤醒
+		var timer *time.Timer
+		var timerC <-chan time.Time
+		if delay := tq.dispatch(); delay > 0 {
+			timer = time.NewTimer(delay)
+			timerC = timer.C
+		}
+
+		select {
+		case <-tq.wakeCh:
+		case <-timerC:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// MoveTask 调整等待中任务的执行顺序。
+// position 为从 0 开始的目标位置，0 表示移到队首，负数表示移到队尾；
+// 移到中间位置时会按新顺序重新编号所有等待任务的优先级
+func (tq *TaskQueue) MoveTask(id int64, position int) error {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	queue, err := tq.db.GetQueueOrder()
+	if err != nil {
+		return err
+	}
+
+	index := -1
+	for i, e := range queue {
+		if e.ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ErrTaskNotQueued
+	}
+
+	entry := queue[index]
+	rest := make([]database.QueueEntry, 0, len(queue))
+	rest = append(rest, queue[:index]...)
+	rest = append(rest, queue[index+1:]...)
+
+	if len(rest) == 0 {
+		return nil
+	}
+
+	priorities := make(map[int64]int)
+	switch {
+	case position == 0:
+		priorities[entry.ID] = rest[0].Priority + 1
+	case position < 0 || position >= len(rest):
+		priorities[entry.ID] = rest[len(rest)-1].Priority - 1
+	default:
+		var ordered []database.QueueEntry
+		ordered = append(ordered, rest[:position]...)
+		ordered = append(ordered, entry)
+		ordered = append(ordered, rest[position:]...)
+
+		// 以队尾原优先级为基准，从后往前递增编号
+		base := rest[len(rest)-1].Priority
+		for i, e := range ordered {
+			priorities[e.ID] = base + len(ordered) - 1 - i
+		}
+	}
+
+	return tq.db.UpdateTaskPriorities(priorities)
+}
+
+// RaisePriority 把等待中任务的优先级提高到 priority，已不低于该值时不变
+func (tq *TaskQueue) RaisePriority(id int64, priority int) error {
+	changed, err := tq.db.RaiseQueuedPriority(id, priority)
+	if err != nil {
+		return err
+	}
+	if changed {
+		tq.wake()
+		return nil
+	}
+
+	queued, err := tq.db.IsQueued(id)
+	if err != nil {
+		return err
+	}
+	if !queued {
+		return ErrTaskNotQueued
+	}
+	return nil
+}
+
+// claimBatchSize 每次从 tasks 表读取的候选任务数
+const claimBatchSize = 50
+
+// readyScan 一轮调度中依次查找可以执行的任务，多次调用 nextReady 时不会重复返回同一个任务。
+// 按提交顺序调度时从上次返回的任务之后继续读取，已查看过的任务不再读取
+type readyScan struct {
+	now    time.Time
+	filter database.ReadyFilter
+	after  *database.QueueCursor
+}
+
+// nextReady 查找 scan 中下一个现在可以执行、且 accept 返回 true 的任务，没有时返回 nil。
+// 启用公平调度时同优先级的任务按分组轮转，否则候选任务分批读取，内存占用与队列长度无关。调用方需持有 mu
+func (tq *TaskQueue) nextReady(scan *readyScan, accept func(*models.Task) bool) (*models.Task, error) {
+	if mode := fairnessMode(); mode != "" {
+		task, err := tq.nextFair(scan.now, mode, scan.filter, accept)
+		if task != nil {
+			scan.filter.ExcludeIDs = append(scan.filter.ExcludeIDs, task.ID)
+		}
+		return task, err
+	}
+
+	for {
+		tasks, err := tq.db.GetReadyTasks(scan.now, scan.filter, scan.after, claimBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range tasks {
+			scan.after = &database.QueueCursor{Priority: task.Priority, ID: task.ID}
+			if accept == nil || accept(task) {
+				return task, nil
+			}
+		}
+		if len(tasks) < claimBatchSize {
+			return nil, nil
+		}
+	}
+}
+
+// blockedTypesLocked 返回现在不能启动的任务类型：不在时间窗口内，或 local 为 true 时本机该类型的并发已满。
+// 同时返回距最近一个时间窗口打开的时间，没有则返回 0。调用方需持有 mu
+func (tq *TaskQueue) blockedTypesLocked(now time.Time, local bool) ([]models.TaskType, time.Duration) {
+	types, err := tq.db.GetClaimableTypes()
+	if err != nil {
+		log.Printf("Failed to get queued task types: %v", err)
+		return nil, 0
+	}
+
+	var blocked []models.TaskType
+	var nextWake time.Duration
+	for _, t := range types {
+		if limit, ok := tq.typeLimits[t]; local && ok && tq.runningByType[t] >= limit {
+			blocked = append(blocked, t)
+			continue
+		}
+		if ok, nextOpen := schedule.WindowsAllow(tq.windows, string(t), now); !ok {
+			blocked = append(blocked, t)
+			if !nextOpen.IsZero() {
+				nextWake = minWake(nextWake, nextOpen.Sub(now))
+			}
+		}
+	}
+	return blocked, nextWake
+}
+
+// minWake 返回两个等待时间中较早的一个，0 表示没有
+func minWake(a, b time.Duration) time.Duration {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// dispatch 按队列顺序从 tasks 表领取可以执行的任务，直到总并发或对应类型的并发达到上限，
+// 运行中任务数已达上限的提交者的任务暂不领取。返回距最近一个被推迟的任务可以启动的时间，没有则返回 0
+func (tq *TaskQueue) dispatch() time.Duration {
+	remote := tq.remoteRunningByOwner()
+
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	// 没有空闲槽位时不必读取队列，任务结束后会再次唤醒
+	if tq.queuePaused || tq.stopping || tq.runningCount >= tq.maxWorkers {
+		return 0
+	}
+
+	now := time.Now()
+	blocked, nextWake := tq.blockedTypesLocked(now, true)
+	scan := &readyScan{now: now, filter: database.ReadyFilter{ExcludeTypes: blocked, ExcludeOwners: tq.blockedOwnersLocked(remote)}}
+	var systemChecked bool
+	var systemReason string
+	for tq.runningCount < tq.maxWorkers {
+		task, err := tq.nextReady(scan, nil)
+		if err != nil {
+			log.Printf("Failed to read task queue: %v", err)
+			break
+		}
+		if task == nil {
+			break
+		}
+
+		// 系统负载、内存不足或输出磁盘空间不足时暂缓启动，稍后重新检查
+		if !systemChecked {
+			systemReason = checkSystemResources()
+			systemChecked = true
+		}
+		reason := systemReason
+		if reason == "" {
+			var dir string
+			if dir, reason = checkDiskSpace(task); reason != "" {
+				// 输出到同一目录下的其他任务也无法启动，直接在查询中排除，不再逐个检查
+				scan.filter.ExcludeDirs = append(scan.filter.ExcludeDirs, dir)
+			}
+		}
+		if reason != "" {
+			tq.deferForResources(task, reason)
+			nextWake = minWake(nextWake, resourceCheckInterval())
+			if systemReason != "" {
+				// 系统资源不足时其他任务也无法启动
+				break
+			}
+			continue
+		}
+
+		// 原子领取，任务可能刚被远程 worker 领取、暂停或取消
+		claimed, err := tq.db.ClaimTask(task.ID)
+		if err != nil {
+			log.Printf("Failed to claim task %d: %v", task.ID, err)
+			break
+		}
+		if !claimed {
+			continue
+		}
+
+		tq.dispatched[task.ID] = task
+		tq.runningCount++
+		tq.runningByType[task.Type]++
+		tq.chargeFairLocked(task)
+		if limit, ok := tq.typeLimits[task.Type]; ok && tq.runningByType[task.Type] >= limit {
+			// 该类型已满，让其他类型的任务先执行
+			scan.filter.ExcludeTypes = append(scan.filter.ExcludeTypes, task.Type)
+		}
+		if task.Owner != "" {
+			tq.runningByOwner[task.Owner]++
+			if limit := ownerLimit(task.Owner); limit > 0 && tq.runningByOwner[task.Owner]+remote[task.Owner] >= limit {
+				scan.filter.ExcludeOwners = append(scan.filter.ExcludeOwners, task.Owner)
+			}
+		}
+		go tq.runWorker(task)
+	}
+
+	// 尚未到开始时间或重试时间的任务，到期后唤醒
+	if at, err := tq.db.NextReadyTime(now); err != nil {
+		log.Printf("Failed to read task queue: %v", err)
+	} else if !at.IsZero() {
+		nextWake = minWake(nextWake, at.Sub(now))
+	}
+	return nextWake
+}
+
+// isDispatched 任务是否已从队列领取、在本机执行
+func (tq *TaskQueue) isDispatched(id int64) bool {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	_, ok := tq.dispatched[id]
+	return ok
+}
+
+// runWorker 在独立 goroutine 中执行任务，结束后释放槽位
+func (tq *TaskQueue) runWorker(task *models.Task) {
+	defer func() {
+		tq.mu.Lock()
+		delete(tq.dispatched, task.ID)
+		tq.runningCount--
+		tq.runningByType[task.Type]--
+		if task.Owner != "" {
+			if tq.runningByOwner[task.Owner]--; tq.runningByOwner[task.Owner] <= 0 {
+				delete(tq.runningByOwner, task.Owner)
+			}
+		}
+		tq.mu.Unlock()
+
+		tq.wake()
+	}()
+
+	tq.processTask(task)
+}
+
+// wake 唤醒调度循环，非阻塞
+func (tq *TaskQueue) wake() {
+	select {
+	case tq.wakeCh <- struct{}{}:
+	default:
 	}
 }
 
@@ -116,11 +543,27 @@ func (tq *TaskQueue) processTask(task *models.Task) {
 		delete(tq.canceledTasks, task.ID)
 		tq.cancelMu.Unlock()
 		log.Printf("Task %d canceled before start, skipping", task.ID)
+		if _, err := tq.db.GetTask(task.ID); err != nil {
+			tq.removeWorkDir(task.ID)
+		}
 		return
 	}
 	tq.cancelMu.Unlock()
 
-	// 更新状态为运行中
+	// 服务正在停止，不再启动新进程，保持 pending 等待下次启动
+	tq.mu.Lock()
+	stopping := tq.stopping
+	tq.mu.Unlock()
+	if stopping {
+		log.Printf("Task %d not started, queue is shutting down", task.ID)
+		tq.db.SetTaskStatus(task.ID, models.TaskStatusPending)
+		return
+	}
+
+	// 更新状态为运行中，并累加执行次数
+	task.Attempts++
+	task.NextAttemptAt = nil
+	tq.db.IncrementTaskAttempts(task.ID)
 	tq.db.UpdateTaskStatus(task.ID, models.TaskStatusRunning, 0, "")
 	tq.notifyProgress(models.ProgressUpdate{
 		TaskID:   task.ID,
@@ -129,15 +572,30 @@ func (tq *TaskQueue) processTask(task *models.Task) {
 		Message:  "Processing started",
 	})
 
-	// 确保输出目录存在
-	outputDir := filepath.Dir(task.OutputPath)
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
+	// 提交后输出路径可能已被其他任务写入
+	if !tq.resolveOutputConflict(task) {
+		return
+	}
+
+	// 检查输入文件是否可访问，NAS 暂时未挂载、文件被占用等情况可以按策略重试
+	input, err := os.Open(task.InputPath)
+	if err != nil {
+		tq.handleTaskError(task, err)
+		return
+	}
+	input.Close()
+
+	// 确保输出目录和临时输出目录存在
+	if err := ffmpeg.PreparePartial(task.OutputPath); err != nil {
 		tq.handleTaskError(task, err)
 		return
 	}
 
 	// 进度回调
 	progressCallback := func(progress float64, message string) {
+		if !tq.touchProgress(task.ID, progress, message) {
+			return
+		}
 		tq.db.UpdateTaskProgress(task.ID, progress)
 		tq.notifyProgress(models.ProgressUpdate{
 			TaskID:   task.ID,
@@ -148,44 +606,82 @@ func (tq *TaskQueue) processTask(task *models.Task) {
 		})
 	}
 
-	// 根据任务类型执行，获取已启动的 FFmpeg 进程
-	var err error
-	var cmd *exec.Cmd
-	switch task.Type {
-	case models.TaskTypeTranscode:
-		cmd, err = tq.ffmpeg.Transcode(task.InputPath, task.OutputPath, task.Params, progressCallback)
-	case models.TaskTypeRemux:
-		cmd, err = tq.ffmpeg.Remux(task.InputPath, task.OutputPath, task.Params, progressCallback)
-	case models.TaskTypeTrim:
-		cmd, err = tq.ffmpeg.Trim(task.InputPath, task.OutputPath, task.Params, progressCallback)
-	case models.TaskTypeThumbnail:
-		cmd, err = tq.ffmpeg.GenerateThumbnails(task.InputPath, task.OutputPath, task.Params, progressCallback)
-	default:
-		err = fmt.Errorf("unknown task type: %s", task.Type)
-	}
+	// 立即登记运行中的任务，进程启动后登记到 rt.cmds，便于暂停和删除时 Kill
+	now := time.Now()
+	tlog := openTaskLog(task, hostname)
+	rt := &runningTask{task: task, cmds: make(map[*exec.Cmd]struct{}), startedAt: now, lastActivity: now, ff: tq.ffmpeg.WithLog(tlog)}
+	tq.cancelMu.Lock()
+	tq.running[task.ID] = rt
+	tq.cancelMu.Unlock()
 
-	if err != nil {
-		log.Printf("Task %d failed to start ffmpeg: %v", task.ID, err)
-		tq.handleTaskError(task, err)
-		return
+	// 看门狗：超时或长时间没有进度时终止进程
+	done := make(chan struct{})
+	go tq.watchTask(rt, done)
+
+	// 根据任务类型执行，等待 FFmpeg 进程结束。输出先写入临时路径，成功后再重命名
+	partialPath := ffmpeg.PartialPath(task.OutputPath)
+	var waitErr error
+	if params, chunked := chunkedParams(task); chunked {
+		waitErr = tq.runChunked(rt, params, partialPath, progressCallback)
+	} else {
+		waitErr = tq.runCmd(rt, func() (*exec.Cmd, error) {
+			return processor.Start(rt.ff, task, task.InputPath, partialPath, progressCallback)
+		}, nil)
+	}
+	close(done)
+	if tlog != nil {
+		if waitErr != nil {
+			tlog.Printf("ffmpeg failed: %v", waitErr)
+		} else {
+			tlog.Printf("ffmpeg finished")
+		}
+		tlog.Close()
 	}
 
-	// 立即设置当前任务和进程，便于删除时 Kill
+	// 清理运行中的任务/进程引用
 	tq.cancelMu.Lock()
-	tq.currentTask = task
-	tq.currentCmd = cmd
+	delete(tq.running, task.ID)
+	if rt.timeoutReason != "" {
+		waitErr = &TimeoutError{Reason: rt.timeoutReason}
+	}
+	interrupted := rt.interrupted
+	lastProgress := rt.lastProgress
+	canceled := tq.canceledTasks[task.ID] && !interrupted
+	if canceled {
+		delete(tq.canceledTasks, task.ID)
+	}
 	tq.cancelMu.Unlock()
 
-	log.Printf("Task %d ffmpeg started, PID: %d", task.ID, cmd.Process.Pid)
+	if canceled {
+		tq.keepCanceled(task, partialPath, lastProgress)
+		return
+	}
 
-	// 等待 FFmpeg 进程结束
-	waitErr := cmd.Wait()
+	// 校验并提交输出；失败、取消或中断时删除不完整的临时输出
+	if waitErr == nil && !interrupted && verifyEnabled() {
+		waitErr = tq.verifyTaskOutput(task, partialPath)
+	}
+	if waitErr == nil && !interrupted {
+		waitErr = ffmpeg.CommitOutput(partialPath, task.OutputPath)
+	}
+	if waitErr != nil || interrupted {
+		if err := ffmpeg.DiscardOutput(partialPath, task.OutputPath); err != nil {
+			log.Printf("Failed to remove partial output of task %d: %v", task.ID, err)
+		}
+	}
 
-	// 清理当前任务/进程引用
-	tq.cancelMu.Lock()
-	tq.currentTask = nil
-	tq.currentCmd = nil
-	tq.cancelMu.Unlock()
+	if interrupted {
+		log.Printf("Task %d interrupted by shutdown", task.ID)
+		tq.db.UpdateTaskStatus(task.ID, models.TaskStatusInterrupted, lastProgress, "interrupted by shutdown")
+		tq.recordEvent(task, models.TaskEventInterrupted, "interrupted by shutdown")
+		tq.notifyProgress(models.ProgressUpdate{
+			TaskID:   task.ID,
+			Status:   string(models.TaskStatusInterrupted),
+			FileName: filepath.Base(task.InputPath),
+			Message:  "Task interrupted by shutdown",
+		})
+		return
+	}
 
 	if waitErr != nil {
 		log.Printf("Task %d ffmpeg process error: %v", task.ID, waitErr)
@@ -193,8 +689,14 @@ func (tq *TaskQueue) processTask(task *models.Task) {
 		return
 	}
 
-	// 任务成功完成
+	tq.recordRuntime(task.Type, time.Since(rt.startedAt))
+	tq.finishTask(task)
+}
+
+// finishTask 记录任务成功完成，并执行删除原文件等后续操作
+func (tq *TaskQueue) finishTask(task *models.Task) {
 	tq.db.UpdateTaskStatus(task.ID, models.TaskStatusFinished, 100, "")
+	tq.recordEvent(task, models.TaskEventFinished, "")
 	tq.notifyProgress(models.ProgressUpdate{
 		TaskID:   task.ID,
 		Progress: 100,
@@ -203,33 +705,105 @@ func (tq *TaskQueue) processTask(task *models.Task) {
 		Message:  "Task completed successfully",
 	})
 
-	// 如果设置了删除原文件
+	// 如果设置了删除原文件，移入回收站，保留期内可以恢复
 	if task.DeleteOriginal {
-		if err := os.Remove(task.InputPath); err != nil {
-			log.Printf("Failed to delete original file %s: %v", task.InputPath, err)
+		if item, err := tq.trashOriginal(task); err != nil {
+			log.Printf("Failed to move original file %s to trash: %v", task.InputPath, err)
 		} else {
-			log.Printf("Deleted original file: %s", task.InputPath)
+			log.Printf("Moved original file %s to trash: %s", task.InputPath, item.TrashPath)
 		}
 	}
 
 	log.Printf("Task %d completed successfully", task.ID)
+	tq.runHooks(task, models.HookEventFinished, nil)
 }
 
-// handleTaskError 处理任务错误
+// handleTaskError 处理任务错误，符合重试策略时安排延迟重试
 func (tq *TaskQueue) handleTaskError(task *models.Task, err error) {
 	log.Printf("Task %d failed: %v", task.ID, err)
 
-	tq.db.UpdateTaskStatus(task.ID, models.TaskStatusError, task.Progress, err.Error())
+	code := classifyError(err)
+	if tq.retryTask(task, err, code) {
+		return
+	}
+
+	task.ErrorLog = err.Error()
+	task.ErrorCode = code
+	tq.db.SetTaskFailed(task.ID, task.Progress, err.Error(), code)
+	tq.recordEvent(task, models.TaskEventFailed, err.Error())
 	tq.cancelMu.Lock()
-	tq.currentTask = nil
-	tq.currentCmd = nil
+	delete(tq.running, task.ID)
 	tq.cancelMu.Unlock()
+	tq.removeWorkDir(task.ID)
 	tq.notifyProgress(models.ProgressUpdate{
-		TaskID:   task.ID,
-		Status:   string(models.TaskStatusError),
-		FileName: filepath.Base(task.InputPath),
-		Message:  fmt.Sprintf("Error: %v", err),
+		TaskID:    task.ID,
+		Status:    string(models.TaskStatusError),
+		FileName:  filepath.Base(task.InputPath),
+		Message:   fmt.Sprintf("Error: %v", err),
+		ErrorCode: code,
 	})
+
+	// 上游失败，下游任务无法执行
+	tq.CancelDependents(task.ID, fmt.Sprintf("upstream task %d failed", task.ID))
+	tq.runHooks(task, models.HookEventFailed, err)
+}
+
+// retryTask 按重试策略把失败的任务放回等待队列，返回是否已安排重试。class 为错误类别，同时作为任务的错误码
+func (tq *TaskQueue) retryTask(task *models.Task, err error, class string) bool {
+	// 已被取消的任务不再重试
+	tq.cancelMu.Lock()
+	canceled := tq.canceledTasks[task.ID]
+	delete(tq.running, task.ID)
+	tq.cancelMu.Unlock()
+	if canceled {
+		return false
+	}
+
+	policy := retryPolicyFor(task)
+	if !shouldRetry(policy, task.Attempts, class) {
+		return false
+	}
+
+	delay := retryDelay(policy, task.Attempts)
+	nextAttemptAt := time.Now().Add(delay)
+	errorLog := fmt.Sprintf("attempt %d/%d failed (%s): %v", task.Attempts, policy.MaxAttempts, class, err)
+	if dbErr := tq.db.ScheduleTaskRetry(task.ID, nextAttemptAt, errorLog, class); dbErr != nil {
+		log.Printf("Failed to schedule retry for task %d: %v", task.ID, dbErr)
+		return false
+	}
+
+	log.Printf("Task %d will retry in %v (%s)", task.ID, delay, errorLog)
+	tq.recordEvent(task, models.TaskEventRetried, fmt.Sprintf("%s, next attempt at %s", errorLog, nextAttemptAt.Format(time.RFC3339)))
+	task.Status = models.TaskStatusPending
+	task.Progress = 0
+	task.ErrorLog = errorLog
+	task.ErrorCode = class
+	task.NextAttemptAt = &nextAttemptAt
+	tq.wake()
+
+	tq.notifyProgress(models.ProgressUpdate{
+		TaskID:    task.ID,
+		Status:    string(models.TaskStatusPending),
+		FileName:  filepath.Base(task.InputPath),
+		Message:   fmt.Sprintf("Retrying in %v: %v", delay.Round(time.Second), err),
+		ErrorCode: class,
+	})
+	return true
+}
+
+// CancelDependents 取消所有直接或间接依赖该任务的下游任务
+func (tq *TaskQueue) CancelDependents(id int64, reason string) {
+	ids, err := tq.db.GetDependentTaskIDs(id)
+	if err != nil {
+		log.Printf("Failed to get dependents of task %d: %v", id, err)
+		return
+	}
+
+	for _, depID := range ids {
+		if err := tq.cancel(depID, reason); err != nil && !errors.Is(err, ErrTaskNotActive) {
+			log.Printf("Failed to cancel task %d: %v", depID, err)
+		}
+	}
 }
 
 // notifyProgress 通知进度更新
@@ -239,19 +813,69 @@ func (tq *TaskQueue) notifyProgress(update models.ProgressUpdate) {
 	}
 }
 
-// CancelTask 取消当前正在执行的任务（如果任务 ID 匹配）
+// CancelTask 取消任务：正在运行则 Kill 对应的 FFmpeg 进程
 func (tq *TaskQueue) CancelTask(id int64) error {
 	tq.cancelMu.Lock()
 	defer tq.cancelMu.Unlock()
 
+	// 远程执行的任务：撤销租约，worker 下次心跳时会停止执行
+	if _, ok := tq.leases[id]; ok {
+		delete(tq.leases, id)
+		return nil
+	}
+
 	// 标记为取消，以便尚未开始的任务被跳过
 	tq.canceledTasks[id] = true
 
-	// 如果当前正在运行的是该任务，尝试 Kill 进程
-	if tq.currentTask != nil && tq.currentTask.ID == id {
-		if tq.currentCmd != nil && tq.currentCmd.Process != nil {
-			return tq.currentCmd.Process.Kill()
-		}
+	// 如果该任务正在运行，尝试 Kill 进程
+	if rt, ok := tq.running[id]; ok {
+		return rt.signalAll(killProcess)
 	}
 	return nil
 }
+
+// Shutdown 停止调度新任务，等待运行中的任务在 grace 内结束；
+// 超时后终止剩余的 FFmpeg 进程组，并将这些任务标记为 interrupted，重启后重新执行
+func (tq *TaskQueue) Shutdown(grace time.Duration) {
+	tq.mu.Lock()
+	tq.stopping = true
+	tq.mu.Unlock()
+
+	if tq.waitIdle(grace) {
+		log.Printf("All running tasks finished")
+		return
+	}
+
+	tq.cancelMu.Lock()
+	for id, rt := range tq.running {
+		rt.interrupted = true
+		log.Printf("Interrupting task %d", id)
+		if err := rt.signalAll(killProcess); err != nil {
+			log.Printf("Failed to kill task %d: %v", id, err)
+		}
+	}
+	tq.cancelMu.Unlock()
+
+	// 等待 processTask 记录中断状态
+	if !tq.waitIdle(5 * time.Second) {
+		log.Printf("Some tasks did not exit in time")
+	}
+}
+
+// waitIdle 等待所有运行中的任务结束，超时返回 false
+func (tq *TaskQueue) waitIdle(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		tq.mu.Lock()
+		running := tq.runningCount
+		tq.mu.Unlock()
+
+		if running == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
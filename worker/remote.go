@@ -0,0 +1,327 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+	"videoforge/config"
+	"videoforge/database"
+	"videoforge/models"
+)
+
+// ErrLeaseLost 租约已过期、被取消或属于其他 worker，远程 worker 应停止执行该任务
+var ErrLeaseLost = errors.New("lease lost")
+
+// ErrLeaseCanceled 任务已被取消，远程 worker 应停止执行并保留临时输出
+var ErrLeaseCanceled = errors.New("task canceled")
+
+// ErrTaskRemote 任务正在远程 worker 上执行，不支持该操作
+var ErrTaskRemote = errors.New("task is running on a remote worker")
+
+// leaseCheckInterval 检查过期租约的间隔
+const leaseCheckInterval = 5 * time.Second
+
+// remoteLease 远程 worker 领取的任务
+type remoteLease struct {
+	task      *models.Task
+	workerID  string
+	expiresAt time.Time
+}
+
+// RemoteError 远程 worker 上报的任务失败
+type RemoteError struct {
+	Class   string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return e.Message
+}
+
+// leaseDuration 远程任务的租约时长
+func leaseDuration() time.Duration {
+	if seconds := config.GlobalConfig.Remote.LeaseDuration; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 60 * time.Second
+}
+
+// pathUnder 判断 path 是否位于 prefix 目录下
+func pathUnder(path, prefix string) bool {
+	path = filepath.Clean(path)
+	prefix = filepath.Clean(prefix)
+	return path == prefix || strings.HasPrefix(path, strings.TrimSuffix(prefix, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// remoteClaimable 判断任务能否交给发出 req 的远程 worker 执行
+func remoteClaimable(task *models.Task, req models.ClaimRequest) bool {
+	if len(req.Types) > 0 {
+		matched := false
+		for _, t := range req.Types {
+			if t == string(task.Type) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	// 分段转码的进度和工作目录保存在服务器上，只在本机执行
+	if _, chunked := chunkedParams(task); chunked {
+		return false
+	}
+
+	// 输入和输出都必须位于 worker 能访问的共享存储上
+	if len(req.PathPrefixes) > 0 {
+		for _, path := range []string{task.InputPath, task.OutputPath} {
+			accessible := false
+			for _, prefix := range req.PathPrefixes {
+				if pathUnder(path, prefix) {
+					accessible = true
+					break
+				}
+			}
+			if !accessible {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ClaimTask 远程 worker 领取下一个可执行的任务，没有可领取的任务时返回 nil。
+// 与本机调度使用相同的优先级、暂停、时间窗口和依赖规则，但不占用本机的并发名额
+func (tq *TaskQueue) ClaimTask(req models.ClaimRequest) (*models.Task, time.Time, error) {
+	for {
+		task, now, err := tq.claimNext(req)
+		if err != nil || task == nil {
+			return nil, time.Time{}, err
+		}
+
+		// 领取的同时被取消或删除：数据库中已标记为 running，改为 canceled 后继续查找下一个
+		tq.cancelMu.Lock()
+		canceled := tq.canceledTasks[task.ID]
+		delete(tq.canceledTasks, task.ID)
+		tq.cancelMu.Unlock()
+		if canceled {
+			log.Printf("Task %d canceled before start, skipping", task.ID)
+			tq.db.SetTaskStatus(task.ID, models.TaskStatusCanceled)
+			continue
+		}
+
+		task.Attempts++
+		task.NextAttemptAt = nil
+		tq.db.IncrementTaskAttempts(task.ID)
+
+		// 先登记租约再检查输出冲突，同时开始的其他任务能看到该任务的输出路径
+		tq.cancelMu.Lock()
+		expiresAt := now.Add(leaseDuration())
+		tq.leases[task.ID] = &remoteLease{task: task, workerID: req.WorkerID, expiresAt: expiresAt}
+		tq.cancelMu.Unlock()
+
+		if !tq.resolveOutputConflict(task) {
+			tq.cancelMu.Lock()
+			delete(tq.leases, task.ID)
+			tq.cancelMu.Unlock()
+			continue
+		}
+
+		task.Status = models.TaskStatusRunning
+		task.WorkerID = req.WorkerID
+		task.LeaseExpiresAt = &expiresAt
+		tq.db.UpdateTaskStatus(task.ID, models.TaskStatusRunning, 0, "")
+		tq.db.SetTaskLease(task.ID, req.WorkerID, &expiresAt)
+
+		log.Printf("Task %d claimed by remote worker %s", task.ID, req.WorkerID)
+		tq.saveEvent(&models.TaskEvent{TaskID: task.ID, Event: models.TaskEventStarted, Attempt: task.Attempts, Host: req.Host, WorkerID: req.WorkerID})
+		tq.notifyProgress(models.ProgressUpdate{
+			TaskID:   task.ID,
+			Status:   string(models.TaskStatusRunning),
+			FileName: filepath.Base(task.InputPath),
+			Message:  fmt.Sprintf("Claimed by worker %s", req.WorkerID),
+		})
+		return task, expiresAt, nil
+	}
+}
+
+// claimNext 在数据库中原子领取下一个适合 req 的任务，没有时返回 nil
+func (tq *TaskQueue) claimNext(req models.ClaimRequest) (*models.Task, time.Time, error) {
+	remote := tq.remoteRunningByOwner()
+
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+	if tq.queuePaused || tq.stopping {
+		return nil, time.Time{}, nil
+	}
+
+	// 远程执行不占用本机的并发名额，只受时间窗口和提交者的并发上限限制
+	now := time.Now()
+	blocked, _ := tq.blockedTypesLocked(now, false)
+	// 类型、共享存储路径和分段转码在查询中过滤，remoteClaimable 再做最终检查
+	filter := database.ReadyFilter{
+		PathPrefixes:   req.PathPrefixes,
+		ExcludeChunked: true,
+		ExcludeTypes:   blocked,
+		ExcludeOwners:  tq.blockedOwnersLocked(remote),
+	}
+	for _, t := range req.Types {
+		filter.Types = append(filter.Types, models.TaskType(t))
+	}
+	scan := &readyScan{now: now, filter: filter}
+	for {
+		task, err := tq.nextReady(scan, func(t *models.Task) bool { return remoteClaimable(t, req) })
+		if err != nil || task == nil {
+			return nil, now, err
+		}
+		// 原子领取，失败说明任务刚被本机调度、暂停或取消，继续查找下一个
+		claimed, err := tq.db.ClaimTask(task.ID)
+		if err != nil {
+			return nil, now, err
+		}
+		if claimed {
+			tq.chargeFairLocked(task)
+			return task, now, nil
+		}
+	}
+}
+
+// leaseLocked 获取属于 workerID 的租约，调用方需持有 cancelMu
+func (tq *TaskQueue) leaseLocked(id int64, workerID string) (*remoteLease, error) {
+	lease, ok := tq.leases[id]
+	if !ok || lease.workerID != workerID {
+		return nil, ErrLeaseLost
+	}
+	return lease, nil
+}
+
+// RenewLease 远程 worker 心跳：续约并转发进度。任务已被取消时返回 ErrLeaseCanceled，
+// 被删除、租约过期或属于其他 worker 时返回 ErrLeaseLost
+func (tq *TaskQueue) RenewLease(id int64, hb models.Heartbeat) (time.Time, error) {
+	tq.cancelMu.Lock()
+	lease, err := tq.leaseLocked(id, hb.WorkerID)
+	if err != nil {
+		tq.cancelMu.Unlock()
+		// 取消时租约已被撤销，任务记录仍在
+		if task, getErr := tq.db.GetTask(id); getErr == nil && task.Status == models.TaskStatusCanceled {
+			if task.WorkerID == hb.WorkerID {
+				tq.db.SetTaskLease(id, "", nil)
+			}
+			return time.Time{}, ErrLeaseCanceled
+		}
+		return time.Time{}, err
+	}
+	lease.expiresAt = time.Now().Add(leaseDuration())
+	expiresAt := lease.expiresAt
+	task := lease.task
+	tq.cancelMu.Unlock()
+
+	task.Progress = hb.Progress
+	task.LeaseExpiresAt = &expiresAt
+	tq.db.SetTaskLease(id, hb.WorkerID, &expiresAt)
+	tq.db.UpdateTaskProgress(id, hb.Progress)
+	tq.notifyProgress(models.ProgressUpdate{
+		TaskID:   id,
+		Progress: hb.Progress,
+		Status:   string(models.TaskStatusRunning),
+		FileName: filepath.Base(task.InputPath),
+		Message:  hb.Message,
+	})
+	return expiresAt, nil
+}
+
+// CompleteRemoteTask 记录远程 worker 的执行结果，失败时按重试策略处理
+func (tq *TaskQueue) CompleteRemoteTask(id int64, result models.TaskResult) error {
+	tq.cancelMu.Lock()
+	lease, err := tq.leaseLocked(id, result.WorkerID)
+	if err == nil {
+		delete(tq.leases, id)
+	}
+	tq.cancelMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	task := lease.task
+	task.WorkerID = ""
+	task.LeaseExpiresAt = nil
+	tq.db.SetTaskLease(id, "", nil)
+	if result.Verification != nil {
+		task.Verification = result.Verification
+		tq.db.SetTaskVerification(id, result.Verification)
+	}
+
+	if result.Error == "" {
+		log.Printf("Task %d completed by remote worker %s", id, result.WorkerID)
+		tq.finishTask(task)
+	} else {
+		tq.handleTaskError(task, &RemoteError{Class: result.ErrorClass, Message: result.Error})
+	}
+
+	// 下游任务可能已可以执行
+	tq.wake()
+	return nil
+}
+
+// ReleaseLease 远程 worker 放弃任务（例如 worker 停止），任务回到 pending 重新调度
+func (tq *TaskQueue) ReleaseLease(id int64, workerID string) error {
+	tq.cancelMu.Lock()
+	lease, err := tq.leaseLocked(id, workerID)
+	if err == nil {
+		delete(tq.leases, id)
+	}
+	tq.cancelMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Task %d released by remote worker %s", id, workerID)
+	tq.requeueRemote(lease.task, fmt.Sprintf("Released by worker %s", workerID))
+	return nil
+}
+
+// watchLeases 定期把租约过期的远程任务放回等待队列
+func (tq *TaskQueue) watchLeases() {
+	ticker := time.NewTicker(leaseCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		var expired []*remoteLease
+		tq.cancelMu.Lock()
+		for id, lease := range tq.leases {
+			if now.After(lease.expiresAt) {
+				expired = append(expired, lease)
+				delete(tq.leases, id)
+			}
+		}
+		tq.cancelMu.Unlock()
+
+		for _, lease := range expired {
+			log.Printf("Lease of task %d held by worker %s expired", lease.task.ID, lease.workerID)
+			tq.requeueRemote(lease.task, fmt.Sprintf("Lease of worker %s expired", lease.workerID))
+		}
+	}
+}
+
+// requeueRemote 远程任务回到 pending 并重新参与调度
+func (tq *TaskQueue) requeueRemote(task *models.Task, message string) {
+	tq.recordEvent(task, models.TaskEventRequeued, message)
+	task.Status = models.TaskStatusPending
+	task.Progress = 0
+	task.WorkerID = ""
+	task.LeaseExpiresAt = nil
+	tq.db.SetTaskLease(task.ID, "", nil)
+	tq.db.UpdateTaskStatus(task.ID, models.TaskStatusPending, 0, "")
+	tq.wake()
+
+	tq.notifyProgress(models.ProgressUpdate{
+		TaskID:   task.ID,
+		Status:   string(models.TaskStatusPending),
+		FileName: filepath.Base(task.InputPath),
+		Message:  message,
+	})
+}
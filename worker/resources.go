@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"videoforge/config"
+	"videoforge/models"
+)
+
+// errResourceUnsupported 当前系统无法获取该项资源信息，跳过检查
+var errResourceUnsupported = errors.New("resource check not supported on this platform")
+
+// resourceCheckInterval 资源不足时重新检查的间隔
+func resourceCheckInterval() time.Duration {
+	if seconds := config.GlobalConfig.Worker.Resources.CheckInterval; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// checkSystemResources 检查系统负载和可用内存，不足时返回原因
+func checkSystemResources() string {
+	limits := config.GlobalConfig.Worker.Resources
+
+	if limits.MaxLoadAverage > 0 {
+		if load, err := loadAverage(); err == nil && load > limits.MaxLoadAverage {
+			return fmt.Sprintf("load average %.2f exceeds %.2f", load, limits.MaxLoadAverage)
+		}
+	}
+
+	if limits.MinFreeMemoryMB > 0 {
+		if free, err := freeMemory(); err == nil && free < uint64(limits.MinFreeMemoryMB)<<20 {
+			return fmt.Sprintf("free memory %dMB below %dMB", free>>20, limits.MinFreeMemoryMB)
+		}
+	}
+	return ""
+}
+
+// checkDiskSpace 检查任务输出目录所在磁盘的剩余空间，不足时返回检查的目录和原因
+func checkDiskSpace(task *models.Task) (string, string) {
+	minFree := config.GlobalConfig.Worker.Resources.MinFreeDiskMB
+	if minFree <= 0 || task.OutputPath == "" {
+		return "", ""
+	}
+
+	// 输出目录可能尚未创建，向上找到已存在的目录
+	dir := filepath.Dir(task.OutputPath)
+	if outputIsDir(task) {
+		dir = task.OutputPath
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+
+	free, err := freeDiskSpace(dir)
+	if err != nil || free >= uint64(minFree)<<20 {
+		return "", ""
+	}
+	return dir, fmt.Sprintf("free disk space on %s %dMB below %dMB", dir, free>>20, minFree)
+}
+
+// deferForResources 资源不足时把等待中的任务标记为 waiting_resources 并记录原因，
+// 重试中的任务保留上次失败的 errorLog 和 errorCode。原因中含有实时数值，
+// 已在等待的任务只更新原因，不重复记录事件和推送。调用方需持有 mu
+func (tq *TaskQueue) deferForResources(task *models.Task, reason string) {
+	if task.Status == models.TaskStatusWaitingRes {
+		if task.WaitingReason != reason {
+			task.WaitingReason = reason
+			tq.db.SetTaskWaiting(task.ID, reason)
+		}
+		return
+	}
+
+	task.Status = models.TaskStatusWaitingRes
+	task.WaitingReason = reason
+	tq.db.SetTaskWaiting(task.ID, reason)
+	tq.recordEvent(task, models.TaskEventWaitingResources, reason)
+	tq.notifyProgress(models.ProgressUpdate{
+		TaskID:   task.ID,
+		Status:   string(models.TaskStatusWaitingRes),
+		FileName: filepath.Base(task.InputPath),
+		Message:  "Waiting for resources: " + reason,
+	})
+}
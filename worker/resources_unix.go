@@ -0,0 +1,55 @@
+//go:build !windows
+
+package worker
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// loadAverage 读取 1 分钟平均负载，依赖 /proc/loadavg（Linux）
+func loadAverage() (float64, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, errResourceUnsupported
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, errResourceUnsupported
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// freeMemory 读取可用内存（字节），依赖 /proc/meminfo 中的 MemAvailable（Linux）
+func freeMemory() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, errResourceUnsupported
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemAvailable:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb << 10, nil
+		}
+	}
+	return 0, errResourceUnsupported
+}
+
+// freeDiskSpace 获取 path 所在文件系统对普通用户可用的剩余空间（字节）
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
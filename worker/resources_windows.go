@@ -0,0 +1,55 @@
+//go:build windows
+
+package worker
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                 = syscall.NewLazyDLL("kernel32.dll")
+	procGetDiskFreeSpaceExW  = kernel32.NewProc("GetDiskFreeSpaceExW")
+	procGlobalMemoryStatusEx = kernel32.NewProc("GlobalMemoryStatusEx")
+)
+
+// loadAverage Windows 没有平均负载，跳过检查
+func loadAverage() (float64, error) {
+	return 0, errResourceUnsupported
+}
+
+// memoryStatusEx 对应 Win32 MEMORYSTATUSEX
+type memoryStatusEx struct {
+	length               uint32
+	memoryLoad           uint32
+	totalPhys            uint64
+	availPhys            uint64
+	totalPageFile        uint64
+	availPageFile        uint64
+	totalVirtual         uint64
+	availVirtual         uint64
+	availExtendedVirtual uint64
+}
+
+// freeMemory 获取可用物理内存（字节）
+func freeMemory() (uint64, error) {
+	status := memoryStatusEx{}
+	status.length = uint32(unsafe.Sizeof(status))
+	if ret, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); ret == 0 {
+		return 0, err
+	}
+	return status.availPhys, nil
+}
+
+// freeDiskSpace 获取 path 所在磁盘对当前用户可用的剩余空间（字节）
+func freeDiskSpace(path string) (uint64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var freeBytes uint64
+	if ret, _, err := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&freeBytes)), 0, 0); ret == 0 {
+		return 0, err
+	}
+	return freeBytes, nil
+}
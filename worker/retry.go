@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+	"videoforge/config"
+	"videoforge/ffmpeg"
+	"videoforge/models"
+	"videoforge/processor"
+)
+
+// 错误类别，用于判断失败的任务是否可以自动重试
+const (
+	ErrorClassInputNotFound  = "input_not_found"     // 输入文件不存在（例如 NAS 暂时未挂载）
+	ErrorClassIO             = "io_error"            // 文件被占用、I/O 错误等暂时性故障
+	ErrorClassPermission     = "permission_denied"   // 无权限访问
+	ErrorClassInvalidParams  = "invalid_params"      // 任务参数或类型错误
+	ErrorClassFFmpeg         = "ffmpeg_error"        // FFmpeg 非 0 退出，且无法归入下面更具体的类别
+	ErrorClassInvalidData    = "invalid_data"        // 输入文件损坏或不是有效的媒体文件
+	ErrorClassUnknownEncoder = "unknown_encoder"     // 编码器不存在或编码参数错误，通常是预设配置有误
+	ErrorClassDiskFull       = "disk_full"           // 磁盘空间或配额不足
+	ErrorClassKilled         = "killed"              // FFmpeg 被外部信号终止（例如内存不足被系统杀死）
+	ErrorClassTimeout        = "timeout"             // 超过最长运行时间或长时间没有进度被终止
+	ErrorClassVerification   = "verification_failed" // 输出未通过校验
+	ErrorClassConflict       = "output_conflict"     // 输出路径冲突且策略为 fail
+	ErrorClassUnknown        = "unknown"
+)
+
+// ffmpegClasses 从 FFmpeg 失败中细分出的类别，重试策略中的 ffmpeg_error 同样匹配这些类别
+var ffmpegClasses = map[string]bool{
+	ErrorClassInvalidData:    true,
+	ErrorClassUnknownEncoder: true,
+	ErrorClassDiskFull:       true,
+	ErrorClassKilled:         true,
+}
+
+// ffmpegErrorPatterns FFmpeg 错误输出中的关键字及对应的类别，按顺序匹配，不区分大小写
+var ffmpegErrorPatterns = []struct {
+	class    string
+	patterns []string
+}{
+	{ErrorClassDiskFull, []string{"no space left on device", "disk quota exceeded", "file too large"}},
+	{ErrorClassPermission, []string{"permission denied", "operation not permitted"}},
+	{ErrorClassInputNotFound, []string{"no such file or directory"}},
+	{ErrorClassUnknownEncoder, []string{"unknown encoder", "encoder not found", "unknown decoder", "decoder not found",
+		"unrecognized option", "option not found", "error while opening encoder", "error initializing output stream"}},
+	{ErrorClassInvalidData, []string{"invalid data found when processing input", "moov atom not found", "invalid nal unit",
+		"error while decoding", "could not find codec parameters", "corrupt", "truncat"}},
+	{ErrorClassKilled, []string{"received signal"}},
+}
+
+// classifyExit 根据退出状态和错误输出细分 FFmpeg 的失败原因
+func classifyExit(exitErr *exec.ExitError, stderr string) string {
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ErrorClassKilled
+	}
+
+	lower := strings.ToLower(stderr)
+	for _, p := range ffmpegErrorPatterns {
+		for _, s := range p.patterns {
+			if strings.Contains(lower, s) {
+				return p.class
+			}
+		}
+	}
+	return ErrorClassFFmpeg
+}
+
+// classifyError 将错误归类，作为任务的错误码并供重试策略匹配
+func classifyError(err error) string {
+	var exitErr *exec.ExitError
+	var ffmpegErr *ffmpeg.ExitError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var timeoutErr *TimeoutError
+	var remoteErr *RemoteError
+	var verifyErr *VerifyError
+	var conflictErr *ConflictError
+	var paramErr *processor.ParamError
+
+	switch {
+	case errors.As(err, &remoteErr):
+		if remoteErr.Class == "" {
+			return ErrorClassUnknown
+		}
+		return remoteErr.Class
+	case errors.As(err, &timeoutErr):
+		return ErrorClassTimeout
+	case errors.As(err, &verifyErr):
+		return ErrorClassVerification
+	case errors.As(err, &conflictErr):
+		return ErrorClassConflict
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrorClassInputNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return ErrorClassPermission
+	case errors.Is(err, syscall.ENOSPC):
+		return ErrorClassDiskFull
+	case errors.Is(err, syscall.EBUSY), errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EIO),
+		errors.Is(err, syscall.ESTALE), errors.Is(err, syscall.ENOTCONN), errors.Is(err, syscall.ETXTBSY):
+		return ErrorClassIO
+	case errors.Is(err, processor.ErrUnknownType), errors.As(err, &paramErr), errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ErrorClassInvalidParams
+	case errors.As(err, &exitErr):
+		stderr := ""
+		if errors.As(err, &ffmpegErr) {
+			stderr = ffmpegErr.Stderr
+		}
+		return classifyExit(exitErr, stderr)
+	default:
+		return ErrorClassUnknown
+	}
+}
+
+// retryPolicyFor 获取任务的重试策略：任务级 > 按类型配置 > 默认配置
+func retryPolicyFor(task *models.Task) models.RetryPolicy {
+	if task.RetryPolicy != nil {
+		return *task.RetryPolicy
+	}
+	retry := config.GlobalConfig.Worker.Retry
+	if policy, ok := retry.Types[string(task.Type)]; ok {
+		return policy
+	}
+	return retry.Default
+}
+
+// shouldRetry 判断已执行 attempts 次、错误类别为 class 的任务是否还能重试
+func shouldRetry(policy models.RetryPolicy, attempts int, class string) bool {
+	if attempts >= policy.MaxAttempts {
+		return false
+	}
+	for _, c := range policy.RetryOn {
+		if c == class || (c == ErrorClassFFmpeg && ffmpegClasses[class]) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryDelay 计算第 attempts 次执行失败后的等待时间（指数退避）
+func retryDelay(policy models.RetryPolicy, attempts int) time.Duration {
+	multiplier := policy.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	delay := float64(policy.InitialDelay) * math.Pow(multiplier, float64(attempts-1))
+	if policy.MaxDelay > 0 && delay > float64(policy.MaxDelay) {
+		delay = float64(policy.MaxDelay)
+	}
+	return time.Duration(delay * float64(time.Second))
+}
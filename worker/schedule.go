@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"encoding/json"
+	"videoforge/schedule"
+)
+
+// settingTimeWindows 时间窗口在 settings 表中的键
+const settingTimeWindows = "time_windows"
+
+// loadTimeWindows 从 settings 表加载时间窗口
+func (tq *TaskQueue) loadTimeWindows() ([]schedule.TimeWindow, error) {
+	value, err := tq.db.GetSetting(settingTimeWindows)
+	if err != nil || value == "" {
+		return nil, err
+	}
+
+	var windows []schedule.TimeWindow
+	if err := json.Unmarshal([]byte(value), &windows); err != nil {
+		return nil, err
+	}
+	return windows, nil
+}
+
+// TimeWindows 返回当前的时间窗口配置
+func (tq *TaskQueue) TimeWindows() []schedule.TimeWindow {
+	tq.mu.Lock()
+	defer tq.mu.Unlock()
+
+	return append([]schedule.TimeWindow{}, tq.windows...)
+}
+
+// SetTimeWindows 设置并持久化时间窗口：有窗口约束的任务类型只在窗口内启动
+func (tq *TaskQueue) SetTimeWindows(windows []schedule.TimeWindow) error {
+	for _, w := range windows {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(windows)
+	if err != nil {
+		return err
+	}
+	if err := tq.db.SetSetting(settingTimeWindows, string(data)); err != nil {
+		return err
+	}
+
+	tq.mu.Lock()
+	tq.windows = windows
+	tq.mu.Unlock()
+
+	// 窗口可能已放宽，重新调度
+	tq.wake()
+	return nil
+}
@@ -0,0 +1,257 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"videoforge/config"
+	"videoforge/models"
+)
+
+// ErrNotInTrash 文件已被恢复或永久删除
+var ErrNotInTrash = errors.New("file is no longer in trash")
+
+// ErrRestoreConflict 原路径已存在文件，不能覆盖
+var ErrRestoreConflict = errors.New("original path already exists")
+
+// trashDir 回收站根目录
+func trashDir() string {
+	if dir := config.GlobalConfig.Trash.Dir; dir != "" {
+		return dir
+	}
+	return "./trash"
+}
+
+// trashRelPath 原文件在回收站中的相对路径：videoRootDir 下的文件保留相对路径，
+// 其他文件使用去掉盘符后的绝对路径
+func trashRelPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+
+	if root := config.GlobalConfig.VideoRootDir; root != "" {
+		if absRoot, err := filepath.Abs(root); err == nil {
+			if rel, err := filepath.Rel(absRoot, abs); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+				return rel
+			}
+		}
+	}
+
+	vol := filepath.VolumeName(abs)
+	rest := strings.TrimLeft(abs[len(vol):], `/\`)
+	vol = strings.Trim(strings.NewReplacer(":", "", `\`, "_", "/", "_").Replace(vol), "_")
+	return filepath.Join("_abs", vol, rest)
+}
+
+// trashOriginal 把任务的原文件移入回收站并记录
+func (tq *TaskQueue) trashOriginal(task *models.Task) (*models.TrashItem, error) {
+	info, err := os.Stat(task.InputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tq.trashMu.Lock()
+	defer tq.trashMu.Unlock()
+
+	dest := filepath.Join(trashDir(), trashRelPath(task.InputPath))
+	// 同名文件已在回收站中时，加上任务 ID 区分
+	if _, err := os.Stat(dest); err == nil {
+		ext := filepath.Ext(dest)
+		dest = fmt.Sprintf("%s.task%d%s", strings.TrimSuffix(dest, ext), task.ID, ext)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, err
+	}
+	if err := moveFile(task.InputPath, dest); err != nil {
+		return nil, err
+	}
+
+	item := &models.TrashItem{
+		TaskID:       task.ID,
+		OriginalPath: task.InputPath,
+		TrashPath:    dest,
+		Size:         info.Size(),
+		Status:       models.TrashStatusTrashed,
+		TrashedAt:    time.Now(),
+	}
+	if days := config.GlobalConfig.Trash.RetentionDays; days > 0 {
+		expiresAt := item.TrashedAt.AddDate(0, 0, days)
+		item.ExpiresAt = &expiresAt
+	}
+	if err := tq.db.CreateTrashItem(item); err != nil {
+		// 没有记录就无法恢复，把文件移回原处
+		if restoreErr := moveFile(dest, task.InputPath); restoreErr != nil {
+			log.Printf("Failed to move %s back to %s: %v", dest, task.InputPath, restoreErr)
+		}
+		return nil, err
+	}
+	return item, nil
+}
+
+// RestoreTrash 把回收站中的文件移回原路径，原路径已存在文件时返回 ErrRestoreConflict
+func (tq *TaskQueue) RestoreTrash(id int64) (*models.TrashItem, error) {
+	tq.trashMu.Lock()
+	defer tq.trashMu.Unlock()
+
+	item, err := tq.db.GetTrashItem(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Status != models.TrashStatusTrashed {
+		return nil, ErrNotInTrash
+	}
+	if _, err := os.Stat(item.OriginalPath); err == nil {
+		return nil, ErrRestoreConflict
+	}
+
+	if err := os.MkdirAll(filepath.Dir(item.OriginalPath), 0755); err != nil {
+		return nil, err
+	}
+	if err := moveFile(item.TrashPath, item.OriginalPath); err != nil {
+		return nil, err
+	}
+	removeEmptyParents(filepath.Dir(item.TrashPath), trashDir())
+
+	if err := tq.db.MarkTrashRestored(id); err != nil {
+		return nil, err
+	}
+	log.Printf("Restored %s from trash (task %d)", item.OriginalPath, item.TaskID)
+	return tq.db.GetTrashItem(id)
+}
+
+// PurgeTrash 永久删除回收站中的文件
+func (tq *TaskQueue) PurgeTrash(id int64) (*models.TrashItem, error) {
+	tq.trashMu.Lock()
+	defer tq.trashMu.Unlock()
+
+	item, err := tq.db.GetTrashItem(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Status != models.TrashStatusTrashed {
+		return nil, ErrNotInTrash
+	}
+	if err := tq.purgeLocked(item); err != nil {
+		return nil, err
+	}
+	return tq.db.GetTrashItem(id)
+}
+
+func (tq *TaskQueue) purgeLocked(item *models.TrashItem) error {
+	if err := os.RemoveAll(item.TrashPath); err != nil {
+		return err
+	}
+	removeEmptyParents(filepath.Dir(item.TrashPath), trashDir())
+
+	if err := tq.db.MarkTrashPurged(item.ID); err != nil {
+		return err
+	}
+	log.Printf("Purged %s from trash (task %d)", item.TrashPath, item.TaskID)
+	return nil
+}
+
+// PurgeExpiredTrash 永久删除超过保留期限的文件，返回删除的数量
+func (tq *TaskQueue) PurgeExpiredTrash() (int, error) {
+	tq.trashMu.Lock()
+	defer tq.trashMu.Unlock()
+
+	items, err := tq.db.GetExpiredTrashItems(time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, item := range items {
+		if err := tq.purgeLocked(item); err != nil {
+			log.Printf("Failed to purge %s from trash: %v", item.TrashPath, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeTrashLoop 定时清理回收站中过期的文件
+func (tq *TaskQueue) purgeTrashLoop() {
+	interval := time.Duration(config.GlobalConfig.Trash.PurgeInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	for {
+		if _, err := tq.PurgeExpiredTrash(); err != nil {
+			log.Printf("Failed to purge expired trash: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// moveFile 移动文件，跨文件系统时先复制再删除源文件
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	} else if _, statErr := os.Stat(src); statErr != nil {
+		return err
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// removeEmptyParents 自下而上删除空目录，直到 root 为止
+func removeEmptyParents(dir, root string) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return
+	}
+	for {
+		absDir, err := filepath.Abs(dir)
+		if err != nil || absDir == absRoot || !strings.HasPrefix(absDir, absRoot+string(filepath.Separator)) {
+			return
+		}
+		// 目录非空时 Remove 失败，停止向上
+		if os.Remove(absDir) != nil {
+			return
+		}
+		dir = filepath.Dir(absDir)
+	}
+}
@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"time"
+	"videoforge/config"
+	"videoforge/ffmpeg"
+	"videoforge/models"
+	"videoforge/processor"
+)
+
+// VerifyError 输出未通过校验
+type VerifyError struct {
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return "verification failed: " + e.Reason
+}
+
+// verifyEnabled 是否在任务完成后校验输出
+func verifyEnabled() bool {
+	return config.GlobalConfig.Worker.Verify.Enabled
+}
+
+// verifyOutput 校验任务输出：能否打开、是否为空、时长和音视频流是否与输入相符。
+// inputPath、outputPath 为执行任务的机器上的路径，outputPath 可以是尚未提交的临时输出
+func verifyOutput(ff *ffmpeg.FFmpeg, task *models.Task, inputPath, outputPath string) *models.VerifyResult {
+	result := &models.VerifyResult{CheckedAt: time.Now()}
+	fail := func(format string, args ...interface{}) *models.VerifyResult {
+		result.Message = fmt.Sprintf(format, args...)
+		return result
+	}
+
+	// 缩略图：目录中至少有一张非空图片
+	if outputIsDir(task) {
+		entries, err := os.ReadDir(outputPath)
+		if err != nil {
+			return fail("cannot read output directory: %v", err)
+		}
+		images := 0
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil && info.Mode().IsRegular() && info.Size() > 0 {
+				images++
+				result.OutputSize += info.Size()
+			}
+		}
+		if images == 0 {
+			return fail("no thumbnails generated")
+		}
+		result.Passed = true
+		return result
+	}
+
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		return fail("output not found: %v", err)
+	}
+	result.OutputSize = info.Size()
+	if result.OutputSize == 0 {
+		return fail("output is empty")
+	}
+
+	output, err := ff.Probe(outputPath)
+	if err != nil {
+		return fail("cannot open output: %v", err)
+	}
+	result.OutputDuration = output.Duration
+	result.OutputVideo = output.Video
+	result.OutputAudio = output.Audio
+
+	input, err := ff.Probe(inputPath)
+	if err != nil {
+		// 输入无法读取（例如已被移走）时只做基本检查
+		result.Passed = true
+		result.Message = fmt.Sprintf("input not probed: %v", err)
+		return result
+	}
+	result.InputVideo = input.Video
+	result.InputAudio = input.Audio
+
+	video, audio := expectedStreams(input)
+	if output.Video != video {
+		return fail("output has %d video streams, expected %d (input has %d)", output.Video, video, input.Video)
+	}
+	if output.Audio != audio {
+		return fail("output has %d audio streams, expected %d (input has %d)", output.Audio, audio, input.Audio)
+	}
+
+	expected := expectedDuration(task, input.Duration)
+	result.ExpectedDuration = expected
+	if expected > 0 {
+		limits := config.GlobalConfig.Worker.Verify
+		tolerance := math.Max(limits.DurationTolerance, expected*limits.DurationTolerancePercent/100)
+		if diff := math.Abs(output.Duration - expected); diff > tolerance {
+			return fail("output duration %.2fs differs from expected %.2fs by more than %.2fs", output.Duration, expected, tolerance)
+		}
+	}
+
+	result.Passed = true
+	return result
+}
+
+// expectedStreams 输出应有的视频流和音频流数量。处理器使用 FFmpeg 默认的流选择，
+// 分段转码只保留第一路视频和音频，每种类型最多保留一路
+func expectedStreams(input *ffmpeg.ProbeInfo) (video, audio int) {
+	return min(input.Video, 1), min(input.Audio, 1)
+}
+
+// outputIsDir 任务输出是否为目录
+func outputIsDir(task *models.Task) bool {
+	p, err := processor.Get(task.Type)
+	return err == nil && p.OutputIsDir()
+}
+
+// expectedDuration 根据任务类型计算输出的预期时长，无法确定时返回 0
+func expectedDuration(task *models.Task, inputDuration float64) float64 {
+	if inputDuration <= 0 {
+		return 0
+	}
+	p, err := processor.Get(task.Type)
+	if err != nil {
+		return 0
+	}
+	return p.ExpectedDuration(task.Params, inputDuration)
+}
+
+// verifyTaskOutput 校验本机执行的任务输出并记录结果，未通过时返回 VerifyError
+func (tq *TaskQueue) verifyTaskOutput(task *models.Task, outputPath string) error {
+	result := verifyOutput(tq.ffmpeg, task, task.InputPath, outputPath)
+	task.Verification = result
+	if err := tq.db.SetTaskVerification(task.ID, result); err != nil {
+		return err
+	}
+	if !result.Passed {
+		return &VerifyError{Reason: result.Message}
+	}
+	return nil
+}
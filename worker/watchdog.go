@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"time"
+	"videoforge/config"
+)
+
+// TimeoutError 任务因超过最长运行时间或长时间没有进度被终止
+type TimeoutError struct {
+	Reason string
+}
+
+func (e *TimeoutError) Error() string {
+	return "timeout: " + e.Reason
+}
+
+// watchdogInterval 看门狗检查间隔
+const watchdogInterval = 10 * time.Second
+
+// maxRuntimeFor 获取任务类型的最长运行时间，0 表示不限制
+func maxRuntimeFor(taskType string) time.Duration {
+	return time.Duration(config.GlobalConfig.Worker.Timeouts.MaxRuntime[taskType]) * time.Second
+}
+
+// stallTimeout 没有进度的最长时间，0 表示不检测
+func stallTimeout() time.Duration {
+	return time.Duration(config.GlobalConfig.Worker.Timeouts.StallTimeout) * time.Second
+}
+
+// touchProgress 记录运行中任务的进度活动，进度值或 FFmpeg 输出的时间发生变化才算有进展。
+// 任务已被取消、中断或超时时返回 false，进程被终止后输出的进度不再记录
+func (tq *TaskQueue) touchProgress(id int64, progress float64, message string) bool {
+	tq.cancelMu.Lock()
+	defer tq.cancelMu.Unlock()
+
+	rt, ok := tq.running[id]
+	if !ok {
+		return true
+	}
+	if tq.stoppedLocked(rt) {
+		return false
+	}
+	if progress != rt.lastProgress || message != rt.lastMessage {
+		rt.lastProgress = progress
+		rt.lastMessage = message
+		rt.lastActivity = time.Now()
+	}
+	return true
+}
+
+// watchTask 监控运行中的任务，超过最长运行时间或长时间没有进度时 Kill 进程。
+// done 在进程结束后关闭
+func (tq *TaskQueue) watchTask(rt *runningTask, done <-chan struct{}) {
+	maxRuntime := maxRuntimeFor(string(rt.task.Type))
+	stall := stallTimeout()
+	if maxRuntime <= 0 && stall <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			tq.cancelMu.Lock()
+			var reason string
+			switch {
+			case rt.paused:
+				// 暂停期间不计时，恢复时会顺延开始时间和最后活动时间
+			case maxRuntime > 0 && now.Sub(rt.startedAt) > maxRuntime:
+				reason = fmt.Sprintf("exceeded max runtime %v", maxRuntime)
+			case stall > 0 && now.Sub(rt.lastActivity) > stall:
+				reason = fmt.Sprintf("no progress for %v", stall)
+			}
+
+			if reason != "" {
+				rt.timeoutReason = reason
+				log.Printf("Task %d %s, killing ffmpeg", rt.task.ID, reason)
+				if err := rt.signalAll(killProcess); err != nil {
+					log.Printf("Failed to kill task %d: %v", rt.task.ID, err)
+				}
+			}
+			tq.cancelMu.Unlock()
+
+			if reason != "" {
+				return
+			}
+		}
+	}
+}